@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Downloader settings
+	"gopkg.in/natefinch/lumberjack.v2"                              // Size-based rotation of -log-file
+)
+
+// Config holds the tunable settings for a run, populated from command line flags
+type Config struct {
+	sds.Config                          // Settings passed on to the downloader
+	LogLevel           slog.Level       // Minimum level of log messages to print
+	LogJSON            bool             // Print logs as JSON lines instead of text
+	LogFile            string           // Also write logs to this file, rotated by size ("" disables it)
+	LogFileOnly        bool             // With LogFile, write logs only there instead of to stderr too
+	LogMaxSizeMB       int              // Size in MiB at which LogFile is rotated
+	LogMaxBackups      int              // Rotated log files kept beside LogFile (0 keeps them all)
+	DryRun             bool             // Resolve URLs and report target files without downloading
+	ResolveOnly        bool             // "resolve" subcommand: print source and resolved URLs, implies DryRun
+	ListOnly           bool             // Print the output filename of each URL and report collisions, offline
+	HeadCheck          bool             // Resolve each URL and report what a HEAD request finds, without downloading
+	VerifyMirror       bool             // "verify" subcommand: check the output directory against the manifest
+	VerifyHash         bool             // With VerifyMirror, also recompute each file's SHA-256
+	ClearCache         bool             // Delete the resolve cache before resolving anything
+	ClearCacheOnly     bool             // "clear-cache" subcommand: delete the resolve cache and exit
+	URLSource          string           // File of URLs to process, "-" for stdin, empty for the built-in list
+	CSVSource          string           // CSV file of URLs with product codes and languages, "-" for stdin (empty disables it)
+	CSVColumns         csvColumns       // Columns of CSVSource holding each field
+	ResolveWorkers     int              // URLs resolved in parallel, each in its own Chrome tab
+	DownloadWorkers    int              // PDFs downloaded in parallel
+	WorkersAuto        bool             // The worker counts not given explicitly were picked from the CPUs and memory
+	Hosts              hostFilter       // Hosts resolved URLs may be downloaded from
+	Limit              int              // Process only the first Limit URLs (0 means all)
+	OnlyMissing        bool             // Skip source URLs whose file is known to exist without resolving them
+	Languages          []string         // SDS languages to keep, e.g. "EN" (empty or "all" keeps every language)
+	ExcludeUnknownLang bool             // Also skip URLs whose language can't be told
+	SinceFile          string           // File with the start of the last successful run, used as Since and then updated
+	ReportPath         string           // JSON file describing each URL's outcome (empty disables it)
+	Events             string           // Format of the lifecycle events printed to stdout, "ndjson" (empty disables them)
+	StatePath          string           // JSON file tracking each URL's progress, for resuming (empty disables it)
+	Checksums          bool             // Write sha256sums.txt into the output directory
+	Dedupe             sds.DedupeAction // What to do with byte-identical files after a run ("" skips the pass)
+	ManifestPath       string           // CSV manifest of the saved files, written after a run and read by verify
+	ManifestAppend     bool             // Append this run's downloads to ManifestPath with a run column instead of rewriting it
+	MetricsPath        string           // Prometheus textfile to write at the end of the run (empty disables it)
+	Archive            string           // Zip file to collect the PDFs in instead of the output directory
+	FailFast           bool             // Cancel the run at the first failed URL
+	TimeoutTotal       time.Duration    // Ceiling for the whole run (0 means unlimited)
+	Seed               string           // Index page scraped for links instead of the built-in list (empty disables it)
+	SeedPattern        *regexp.Regexp   // Links on the seed page that are processed
+}
+
+// Parses the command line flags into a Config, validating values that can fail
+func parseConfig() (*Config, error) {
+	config := &Config{}
+	var minFreeMB uint64
+
+	flag.StringVar(&config.OutputDir, "output-dir", "PDFs/", "directory to store downloaded PDFs")
+	nameTemplate := flag.String("name-template", "", "text/template for output filenames using {{.Name}}, {{.Code}}, {{.Lang}}, {{.Host}}, {{.BaseDomain}} and {{.Ext}} (e.g. \"{{.BaseDomain}}-{{.Code}}.{{.Ext}}\")")
+	directURL := flag.String("direct-url", "", "text/template building the direct PDF URL of a spheracloud LoginFetch.aspx URL from {{.SearchValue}}, {{.Code}}, {{.Region}}, {{.Lang}} and {{.Host}}; tried over plain HTTP before falling back to the browser")
+	flag.BoolVar(&config.TagLanguages, "tag-languages", false, "name direct PDF links with their language like spheracloud documents: 631310001-s.pdf as 631310001_es.pdf, 631310001.pdf as 631310001_en.pdf")
+	filenameCase := flag.String("filename-case", string(sds.CaseLower), "letter case of output filenames: lower (c10005b.pdf), upper (C10005B.pdf) or preserve (as spelled in the URL)")
+	nameFrom := flag.String("output-name-from", "header,query,url", "comma-separated order of filename sources: header (Content-Disposition), query (spheracloud searchvalue), url (path)")
+	layout := flag.String("output-layout", string(sds.LayoutFlat), "arrangement of saved files: flat (colliding names get a URL hash suffix) or by-host (mirror host/path)")
+	preservePaths := flag.Bool("preserve-paths", false, "same as -output-layout by-host")
+	flag.BoolVar(&config.Refresh, "refresh", false, "re-download existing files when the server's ETag, Last-Modified or size changed")
+	flag.Int64Var(&config.MinSize, "min-size", 1024, "smallest download in bytes accepted as a PDF; smaller ones are retried like other transient failures (-download-retries), then fail")
+	flag.BoolVar(&config.ValidatePDF, "validate-pdf", false, "parse each PDF and move corrupt, truncated or password-protected ones to invalid/ in the output directory")
+	sinceFlag := flag.String("since", "", "skip documents last modified before this RFC3339 time, date (2006-01-02) or age (e.g. 720h)")
+	flag.StringVar(&config.SinceFile, "since-file", "", "file holding the start time of the last successful run, used like -since and updated after each successful run (a missing file fetches everything)")
+	flag.BoolVar(&config.Verify, "verify", false, "re-download existing files whose SHA-256 no longer matches the one recorded when they were saved")
+	flag.BoolVar(&config.Overwrite, "overwrite", false, "re-download existing files and replace them atomically")
+	flag.BoolVar(&config.IgnoreRobots, "ignore-robots", false, "download URLs even when the site's robots.txt disallows them")
+	contentTypes := flag.String("content-types", strings.Join(sds.DefaultContentTypes, ","), "comma-separated Content-Types accepted as PDFs (bodies starting with %PDF- are accepted too, see -trust-magic)")
+	trustMagic := flag.Bool("trust-magic", true, "accept a body starting with %PDF- whatever Content-Type it is served as; with -trust-magic=false only a missing Content-Type falls back to the signature")
+	acceptStatus := flag.String("accept-status", "200", "comma-separated HTTP statuses whose response body is saved as the document, e.g. 200,203; anything else is a failure")
+	flag.Var((*stringList)(&config.UserAgents), "user-agent", "User-Agent for the browser and downloads; repeat to rotate through a pool")
+	var cookies, headers stringList
+	flag.Var(&cookies, "cookie", "cookie sent with every download as name=value; repeatable")
+	flag.Var(&headers, "header", "header sent with every download as \"Key: Value\"; repeatable")
+	netrcPath := flag.String("netrc", "", "file in .netrc format with basic auth credentials by host, for downloads and the browser")
+	var mirrorHosts stringList
+	flag.Var(&mirrorHosts, "mirror-host", "when a download from a host fails, try the same path once on a mirror, given as host=mirror (e.g. docs.citgo.com=mirror.example.org); repeatable")
+	proxyFlag := flag.String("proxy", "", "HTTP(S) or SOCKS5 proxy URL (defaults to HTTP_PROXY/HTTPS_PROXY, except for NO_PROXY hosts)")
+	resolverFlag := flag.String("resolver", "", "DNS server for downloads, as an IP address with optional port (e.g. 1.1.1.1 or [2606:4700:4700::1111]:53) or a DNS-over-HTTPS URL (e.g. https://1.1.1.1/dns-query)")
+	proxiesFile := flag.String("proxies", "", "file of proxy URLs, one per line, rotated across downloads and browser launches")
+	proxyRotation := flag.String("proxy-rotation", string(sds.ProxyRoundRobin), "order in which -proxies are used: round-robin or random")
+	flag.BoolVar(&config.Insecure, "insecure", false, "skip TLS certificate verification, e.g. for internal mirrors with self-signed certificates (unsafe)")
+	flag.BoolVar(&config.NoCache, "no-cache", false, "resolve every URL in the browser instead of reusing cached results")
+	flag.DurationVar(&config.CacheTTL, "cache-ttl", 7*24*time.Hour, "how long a cached resolved URL is reused before resolving it again")
+	flag.BoolVar(&config.ClearCache, "clear-cache", false, "delete the resolve cache before the run, so every URL is resolved in the browser and cached afresh")
+	flag.DurationVar(&config.DownloadTimeout, "download-timeout", 15*time.Minute, "timeout for a single PDF download")
+	flag.IntVar(&config.DownloadRetries, "download-retries", 3, "extra attempts when a download fails transiently (network error, timeout, truncated body, 5xx or 429); interrupted transfers resume where they stopped")
+	flag.DurationVar(&config.DownloadBackoff, "download-backoff", time.Second, "wait before the first download retry; doubled for each retry after it")
+	maxRate := flag.String("max-rate", "", "combined download bandwidth limit such as 1MB/s, 500KiB/s or a number of bytes per second (default unlimited)")
+	maxSize := flag.String("max-size", "100MB", "largest download accepted, such as 100MB or 1GiB; bigger ones fail without being saved (0 for no limit)")
+	flag.StringVar(&config.ChromePath, "chrome-path", "", "Chrome or Chromium executable to launch (found automatically by default)")
+	flag.BoolVar(&config.Headful, "headful", false, "show the browser window while resolving, for debugging (try with -limit 1)")
+	flag.Var((*stringList)(&config.ChromeFlags), "chrome-flag", "extra Chrome command line switch such as --disable-dev-shm-usage; repeatable")
+	flag.DurationVar(&config.NavigateTimeout, "navigate-timeout", 2*time.Minute, "timeout for the browser resolving a URL")
+	flag.IntVar(&config.NavigateRetries, "resolve-retries", 1, "extra attempts when the browser fails to load a URL (crash, timeout or network error); each one costs a new tab and a full page load")
+	flag.IntVar(&config.NavigateRetries, "navigate-retries", 1, "same as -resolve-retries")
+	flag.DurationVar(&config.NavigateBackoff, "navigate-backoff", 2*time.Second, "wait before the first navigation retry; doubled for each retry after it")
+	flag.DurationVar(&config.SettleStable, "settle-stable", 750*time.Millisecond, "how long a page's URL must stay unchanged before it counts as settled")
+	flag.DurationVar(&config.SettleMax, "settle-max", 10*time.Second, "longest wait for a page's URL to settle after load")
+	var hostSettle stringList
+	flag.Var(&hostSettle, "settle-host", "longest settle wait for a host and its subdomains as host=duration (e.g. docs.citgo.com=0s), replacing -settle-max, or -redirect-settle with -fixed-settle; repeatable")
+	flag.BoolVar(&config.FixedSettle, "fixed-settle", false, "always wait -redirect-settle after page load instead of until the URL settles")
+	flag.DurationVar(&config.RedirectSettleDelay, "redirect-settle", 3*time.Second, "with -fixed-settle, time to let JS/meta redirects fire after page load")
+	flag.DurationVar(&config.RedirectLoopTimeout, "redirect-loop-timeout", 3*time.Minute, "cutoff for following a chain of redirects")
+	flag.BoolVar(&config.ExtractPDFLink, "extract-pdf-link", false, "when a URL resolves to a viewer page, download the PDF it embeds or links to instead")
+	flag.StringVar(&config.SaveHTMLDir, "save-html", "", "directory to save the HTML of resolved pages that aren't PDFs, for debugging")
+	blockedPattern := flag.String("blocked-pattern", sds.DefaultBlockedPattern, "regexp for the title or text of access-denied or captcha pages, reported as blocked (empty to disable)")
+	flag.DurationVar(&config.BlockedRetryDelay, "blocked-retry-delay", 0, "when a URL resolves to a page matching -blocked-pattern, wait this long and resolve it once more (0 to give up at once)")
+	flag.Uint64Var(&minFreeMB, "min-free-mb", 100, "abort when the output filesystem has less than this many MiB free (0 to disable)")
+	flag.IntVar(&config.MaxRedirects, "max-redirects", 10, "most browser navigations per URL while following redirects (0 for no limit)")
+	flag.TextVar(&config.LogLevel, "log-level", slog.LevelWarn, "minimum log level: debug, info, warn or error")
+	var quiet, verbose bool
+	flag.BoolVar(&quiet, "q", false, "shorthand for -quiet")
+	flag.BoolVar(&quiet, "quiet", false, "print only errors and the final summary (same as -log-level error)")
+	flag.BoolVar(&verbose, "v", false, "shorthand for -verbose")
+	flag.BoolVar(&verbose, "verbose", false, "print everything, including debug messages (same as -log-level debug)")
+	flag.BoolVar(&config.LogJSON, "log-json", false, "print logs as JSON lines")
+	flag.StringVar(&config.LogFile, "log-file", "", "also write logs to this file, rotating it once it reaches -log-max-size")
+	flag.BoolVar(&config.LogFileOnly, "log-file-only", false, "with -log-file, write logs only to the file instead of to stderr too")
+	flag.IntVar(&config.LogMaxSizeMB, "log-max-size", 10, "with -log-file, size in MiB at which the log file is rotated")
+	flag.IntVar(&config.LogMaxBackups, "log-max-backups", 5, "with -log-file, rotated log files to keep (0 keeps them all)")
+	flag.BoolVar(&config.DryRun, "dry-run", false, "resolve URLs and print the files they would produce, without downloading")
+	flag.BoolVar(&config.ListOnly, "list-only", false, "print the output filename each input URL would get and report collisions, without Chrome or network access")
+	flag.BoolVar(&config.HeadCheck, "head-check", false, "resolve each URL and print its HTTP status, Content-Type and Content-Length from a HEAD request, without downloading")
+	flag.StringVar(&config.Seed, "seed", "", "index page whose matching links are processed instead of the built-in list")
+	seedPattern := flag.String("seed-pattern", sds.DefaultSeedPattern, "regexp an absolute link on the -seed page must match to be processed")
+	flag.StringVar(&config.URLSource, "urls", "", "file of newline-delimited URLs, or - for stdin (piped stdin is read automatically)")
+	flag.StringVar(&config.CSVSource, "csv", "", "CSV file of URLs with product codes and languages, or - for stdin, used instead of -urls")
+	flag.StringVar(&config.CSVColumns.URL, "csv-url-column", defaultCSVURLColumn, "header name or 1-based number of the -csv column holding the URL")
+	flag.StringVar(&config.CSVColumns.Code, "csv-code-column", defaultCSVCodeColumn, "header name or 1-based number of the -csv column holding the product code, used as {{.Code}} in names (empty for none)")
+	flag.StringVar(&config.CSVColumns.Lang, "csv-lang-column", defaultCSVLangColumn, "header name or 1-based number of the -csv column holding the SDS language, used by -lang and as {{.Lang}} in names (empty for none)")
+	allowHosts := flag.String("allow-hosts", "", "comma-separated hosts to download from, including their subdomains (default all)")
+	denyHosts := flag.String("deny-hosts", "", "comma-separated hosts never to download from, including their subdomains")
+	flag.IntVar(&config.ResolveWorkers, "resolve-workers", 2, "number of URLs resolved in parallel, each in its own browser tab")
+	flag.IntVar(&config.TabPool, "tab-pool", 0, "browser tabs kept open and reused across URLs instead of opening a new tab for each (0 disables the pool)")
+	flag.BoolVar(&config.TabReset, "tab-reset", false, "with -tab-pool, give each pooled tab its own cookies and clear them and the cache between URLs")
+	flag.IntVar(&config.DownloadWorkers, "download-workers", 4, "number of PDFs downloaded in parallel")
+	workers := flag.String("workers", "", "\"auto\" picks -resolve-workers and -download-workers from the CPUs and available memory; explicit counts still win")
+	flag.IntVar(&config.MaxPerHost, "concurrency-per-host", 2, "most simultaneous browser navigations or downloads against one host (0 for no limit)")
+	flag.DurationVar(&config.GlobalInterval, "global-interval", 0, "least time between the starts of any two browser navigations or downloads, across all hosts (0 for no limit)")
+	flag.BoolVar(&config.OnlyMissing, "only-missing", false, "skip URLs whose file already exists without resolving them, where the name can be told from the URL (direct .pdf links)")
+	flag.IntVar(&config.Limit, "limit", 0, "process only the first N unique URLs (0 for all)")
+	languages := flag.String("lang", "all", "comma-separated SDS languages to download, e.g. EN or EN,ES, read from spheracloud searchvalues (all for every language)")
+	flag.BoolVar(&config.ExcludeUnknownLang, "lang-exclude-unknown", false, "with -lang, also skip URLs whose language is unknown (e.g. direct PDF links)")
+	flag.StringVar(&config.ReportPath, "report", "", "write a JSON report of every URL's outcome to this file (e.g. report.json)")
+	flag.StringVar(&config.Events, "events", "", "print a line to stdout for each URL's resolve-start, resolve-done, download-start, download-done, skipped and error events as they happen; the only format is ndjson")
+	flag.StringVar(&config.StatePath, "state", "", "JSON file recording each URL's progress; URLs it marks done are skipped on the next run unless -overwrite is set")
+	flag.StringVar(&config.ManifestPath, "manifest", "", "write a CSV manifest of the saved files (path, url, size, sha256, downloaded) to this file; verify reads it (default manifest.csv in the output directory)")
+	flag.BoolVar(&config.ManifestAppend, "manifest-append", false, "with -manifest, append a row for each file downloaded in this run, stamped with the run's start time, instead of rewriting the manifest")
+	flag.BoolVar(&config.VerifyHash, "verify-hash", false, "with verify, recompute every file's SHA-256 instead of only comparing sizes")
+	flag.BoolVar(&config.Checksums, "sha256sums", false, "write sha256sums.txt in the output directory for verifying the PDFs with sha256sum -c")
+	dedupe := flag.String("dedupe-by-content", "", "after the run, find saved files with identical content and report them in duplicates.csv (report), replace all but one with symlinks (symlink) or delete them (delete)")
+	flag.StringVar(&config.MetricsPath, "metrics-file", "", "write Prometheus metrics for the run to this file (e.g. for node_exporter's textfile collector)")
+	flag.BoolVar(&config.FailFast, "fail-fast", false, "stop the whole run, cancelling work in flight, at the first URL that fails to resolve or download")
+	flag.DurationVar(&config.TimeoutTotal, "timeout-total", 0, "stop the whole run cleanly after this long, e.g. 30m (0 for no limit)")
+	flag.StringVar(&config.Archive, "archive", "", "write the PDFs into this zip file instead of the output directory")
+	flag.Usage = usage
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "resolve": // Only the browser step, as a standalone tool
+			config.ResolveOnly = true
+			args = args[1:]
+		case "verify": // Integrity check of an existing mirror, no network at all
+			config.VerifyMirror = true
+			args = args[1:]
+		case "clear-cache": // Forget every cached resolution, then stop
+			config.ClearCache, config.ClearCacheOnly = true, true
+			args = args[1:]
+		}
+	}
+	flag.CommandLine.Parse(args) // Parse command line flags; exits on errors
+	if config.HeadCheck && (config.ResolveOnly || config.ListOnly) {
+		return nil, errors.New("-head-check can't be combined with -list-only or resolve")
+	}
+	config.DryRun = config.DryRun || config.ResolveOnly || config.ListOnly || config.HeadCheck // No mode writes files
+	if config.ManifestAppend && config.ManifestPath == "" && !config.VerifyMirror {
+		return nil, errors.New("-manifest-append needs -manifest")
+	}
+	if config.VerifyMirror && config.ManifestPath == "" {
+		config.ManifestPath = filepath.Join(config.OutputDir, manifestFilename)
+	}
+
+	if config.OnlyMissing && (config.Overwrite || config.Refresh || config.Verify) {
+		return nil, errors.New("-only-missing can't be combined with -overwrite, -refresh or -verify, which re-check existing files")
+	}
+	if config.Events != "" {
+		if config.Events != "ndjson" {
+			return nil, fmt.Errorf("unknown -events format %q (want \"ndjson\")", config.Events)
+		}
+		if config.DryRun {
+			return nil, errors.New("-events can't be combined with -dry-run, -list-only, -head-check or resolve, which print to stdout")
+		}
+	}
+	if config.TabReset && config.TabPool <= 0 {
+		return nil, errors.New("-tab-reset needs -tab-pool; without the pool every URL gets a new tab anyway")
+	}
+	if err := applyVerbosity(config, quiet, verbose); err != nil {
+		return nil, err
+	}
+	if config.LogFileOnly && config.LogFile == "" {
+		return nil, errors.New("-log-file-only needs -log-file")
+	}
+	if config.LogFile != "" && (config.LogMaxSizeMB <= 0 || config.LogMaxBackups < 0) {
+		return nil, errors.New("-log-max-size must be positive and -log-max-backups not negative")
+	}
+
+	switch *workers {
+	case "":
+	case "auto":
+		config.WorkersAuto = true
+		resolve, download := autoWorkers()
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["resolve-workers"] {
+			config.ResolveWorkers = resolve
+		}
+		if !set["download-workers"] {
+			config.DownloadWorkers = download
+		}
+	default:
+		return nil, fmt.Errorf("unknown -workers value %q (want \"auto\")", *workers)
+	}
+
+	config.IdleConnsPerHost = config.DownloadWorkers // A warm connection for each concurrent download
+	if config.MaxPerHost > 0 {
+		config.IdleConnsPerHost = min(config.IdleConnsPerHost, config.MaxPerHost) // No host sees more at once
+	}
+	config.ContentTypes = splitList(*contentTypes)
+	config.DistrustMagic = !*trustMagic
+	config.Languages = splitList(*languages)
+	config.MinFreeSpace = minFreeMB << 20
+	config.Hosts = hostFilter{allow: splitList(*allowHosts), deny: splitList(*denyHosts)}
+
+	since, err := parseSince(*sinceFlag, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if config.SinceFile != "" {
+		if *sinceFlag != "" {
+			return nil, errors.New("-since and -since-file can't be combined")
+		}
+		if since, err = readSinceFile(config.SinceFile); err != nil {
+			return nil, fmt.Errorf("invalid -since-file: %w", err)
+		}
+	}
+	config.Since = since
+
+	if config.Layout, err = sds.ParseLayout(*layout); err != nil {
+		return nil, err
+	}
+	if *netrcPath != "" {
+		if config.Netrc, err = sds.ReadNetrc(*netrcPath); err != nil {
+			return nil, fmt.Errorf("-netrc: %w", err)
+		}
+	}
+	if config.FilenameCase, err = sds.ParseFilenameCase(*filenameCase); err != nil {
+		return nil, err
+	}
+	if *preservePaths {
+		config.Layout = sds.LayoutByHost
+	}
+	if config.AcceptStatus, err = parseStatusCodes(*acceptStatus); err != nil {
+		return nil, err
+	}
+	if *dedupe != "" {
+		if config.Dedupe, err = sds.ParseDedupeAction(*dedupe); err != nil {
+			return nil, err
+		}
+		if config.Archive != "" {
+			return nil, errors.New("-dedupe-by-content can't be combined with -archive, which saves no files to deduplicate")
+		}
+	}
+
+	if *blockedPattern != "" {
+		if config.BlockedPattern, err = regexp.Compile(*blockedPattern); err != nil {
+			return nil, fmt.Errorf("invalid -blocked-pattern: %w", err)
+		}
+	}
+	if config.SeedPattern, err = regexp.Compile(*seedPattern); err != nil {
+		return nil, fmt.Errorf("invalid -seed-pattern: %w", err)
+	}
+	if config.Seed != "" && !sds.IsURLValid(config.Seed) {
+		return nil, fmt.Errorf("invalid -seed URL %q", config.Seed)
+	}
+	if config.Seed != "" && config.ListOnly {
+		return nil, errors.New("-list-only can't be combined with -seed, which needs the browser")
+	}
+
+	if config.NameSources, err = sds.ParseNameSources(splitList(*nameFrom)); err != nil {
+		return nil, err
+	}
+	if config.CSVSource != "" {
+		if config.URLSource != "" {
+			return nil, errors.New("-csv and -urls can't be combined")
+		}
+		if strings.TrimSpace(config.CSVColumns.URL) == "" {
+			return nil, errors.New("-csv-url-column can't be empty")
+		}
+		if *nameTemplate == "" { // Names come from the CSV's product codes and languages
+			*nameTemplate = defaultCSVNameTemplate
+		}
+	}
+	if *directURL != "" {
+		if config.DirectURL, err = sds.ParseDirectTemplate(*directURL); err != nil {
+			return nil, err
+		}
+	}
+	if *nameTemplate != "" { // Reject a broken template before resolving anything
+		if config.NameTemplate, err = sds.ParseNameTemplate(*nameTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.MaxRate, err = parseRate(*maxRate); err != nil {
+		return nil, err
+	}
+	if config.MaxSize, err = parseSize(*maxSize); err != nil {
+		return nil, fmt.Errorf("invalid -max-size: %w", err)
+	}
+	if config.MirrorHosts, err = parseMirrorHosts(mirrorHosts); err != nil {
+		return nil, err
+	}
+	if config.HostSettle, err = parseHostDurations(hostSettle); err != nil {
+		return nil, err
+	}
+	if config.Cookies, err = parseCookies(cookies); err != nil {
+		return nil, err
+	}
+	if config.Headers, err = parseHeaders(headers); err != nil {
+		return nil, err
+	}
+
+	if config.ChromePath != "" && !sds.FileExists(config.ChromePath) { // Fail before the first URL instead of on each one
+		return nil, fmt.Errorf("chrome executable %q not found", config.ChromePath)
+	}
+
+	if rawProxy := strings.TrimSpace(*proxyFlag); rawProxy != "" { // Without it, the proxy environment variables apply
+		if config.ProxyURL, err = parseProxyURL(rawProxy); err != nil { // Fail fast on a bad proxy instead of going direct
+			return nil, err
+		}
+	}
+	if *proxiesFile != "" {
+		if *proxyFlag != "" {
+			return nil, errors.New("-proxy and -proxies can't be combined")
+		}
+		if config.Proxies, err = loadProxies(*proxiesFile); err != nil {
+			return nil, err
+		}
+	}
+	if config.ProxyRotation, err = sds.ParseProxyRotation(*proxyRotation); err != nil {
+		return nil, err
+	}
+	if config.Resolver, err = sds.NewResolver(*resolverFlag); err != nil {
+		return nil, fmt.Errorf("invalid -resolver: %w", err)
+	}
+
+	return config, nil
+}
+
+// Prints the command line help, including the subcommands
+func usage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage: %s [resolve|verify|clear-cache] [flags]\n\n", os.Args[0])
+	fmt.Fprintln(output, "Without a subcommand, resolves and downloads every URL. \"resolve\" only runs the")
+	fmt.Fprintln(output, "browser step and prints \"source<TAB>resolved\" lines to stdout. \"verify\" checks")
+	fmt.Fprintln(output, "the output directory against -manifest and prints missing, corrupt and extra files.")
+	fmt.Fprintln(output, "\"clear-cache\" deletes the resolve cache in the output directory.")
+	fmt.Fprintln(output)
+	flag.PrintDefaults()
+}
+
+// Lets -quiet or -verbose pick the log level, rejecting them together or with an
+// explicit -log-level
+func applyVerbosity(config *Config, quiet, verbose bool) error {
+	logLevelSet := false
+	flag.Visit(func(f *flag.Flag) { logLevelSet = logLevelSet || f.Name == "log-level" })
+	switch {
+	case quiet && verbose:
+		return errors.New("-quiet and -verbose can't be combined")
+	case (quiet || verbose) && logLevelSet:
+		return errors.New("-quiet and -verbose can't be combined with -log-level")
+	case quiet:
+		config.LogLevel = slog.LevelError
+	case verbose:
+		config.LogLevel = slog.LevelDebug
+	}
+	return nil
+}
+
+// A flag.Value collecting every occurrence of a repeatable string flag
+type stringList []string
+
+// Returns the values joined with commas
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+// Appends one occurrence of the flag
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// Multipliers for the units accepted by -max-rate and -max-size
+var sizeUnits = map[string]int64{
+	"": 1, "b": 1,
+	"kb": 1000, "kib": 1 << 10,
+	"mb": 1000 * 1000, "mib": 1 << 20,
+	"gb": 1000 * 1000 * 1000, "gib": 1 << 30,
+}
+
+// Parses a size such as "100MB", "512KiB" or "65536" into bytes; an empty
+// value is zero
+func parseSize(value string) (int64, error) {
+	text := strings.ToLower(strings.TrimSpace(value))
+	if text == "" {
+		return 0, nil
+	}
+	number := strings.TrimRightFunc(text, unicode.IsLetter)
+	multiplier, ok := sizeUnits[strings.TrimSpace(text[len(number):])]
+	amount, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if !ok || err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid size %q: want a number of bytes such as 100MB", value)
+	}
+	return int64(amount * float64(multiplier)), nil
+}
+
+// Parses a -max-rate value such as "1MB/s" into bytes per second; an empty
+// value means no limit
+func parseRate(value string) (int64, error) {
+	rate, err := parseSize(strings.TrimSuffix(strings.TrimSpace(value), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid -max-rate %q: want a rate such as 1MB/s", value)
+	}
+	return rate, nil
+}
+
+// Parses the comma-separated HTTP statuses of -accept-status, such as "200,203"
+func parseStatusCodes(value string) ([]int, error) {
+	var codes []int
+	for _, item := range splitList(value) {
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid -accept-status %q: want HTTP status codes such as 200,203", item)
+		}
+		codes = append(codes, code)
+	}
+	if len(codes) == 0 {
+		return nil, errors.New("-accept-status needs at least one status")
+	}
+	return codes, nil
+}
+
+// Parses repeated -mirror-host values of the form host=mirror, where the mirror
+// may carry a port (e.g. mirror.example.org:8080)
+func parseMirrorHosts(values []string) (map[string]string, error) {
+	mirrors := make(map[string]string)
+	for _, value := range values {
+		host, mirror, found := strings.Cut(value, "=")
+		host, mirror = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(mirror)
+		if !found || host == "" || mirror == "" || strings.ContainsAny(mirror, "/?#@") {
+			return nil, fmt.Errorf("invalid -mirror-host %q: want host=mirror, e.g. docs.citgo.com=mirror.example.org", value)
+		}
+		mirrors[host] = mirror
+	}
+	return mirrors, nil
+}
+
+// Parses repeated -settle-host values of the form host=duration
+func parseHostDurations(values []string) (sds.HostDurations, error) {
+	durations := make(sds.HostDurations)
+	for _, value := range values {
+		host, wait, found := strings.Cut(value, "=")
+		host = strings.TrimSpace(host)
+		duration, err := time.ParseDuration(strings.TrimSpace(wait))
+		if !found || host == "" || err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid -settle-host %q: want host=duration, e.g. docs.citgo.com=0s", value)
+		}
+		durations[host] = duration
+	}
+	return durations, nil
+}
+
+// Parses repeated -cookie values of the form name=value
+func parseCookies(values []string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	for _, value := range values {
+		name, cookieValue, found := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid -cookie %q: want name=value", value)
+		}
+		cookie := &http.Cookie{Name: name, Value: strings.TrimSpace(cookieValue)}
+		if err := cookie.Valid(); err != nil {
+			return nil, fmt.Errorf("invalid -cookie %q: %w", value, err)
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies, nil
+}
+
+// Parses repeated -header values of the form "Key: Value"
+func parseHeaders(values []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, value := range values {
+		key, headerValue, found := strings.Cut(value, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid -header %q: want \"Key: Value\"", value)
+		}
+		headers.Add(key, strings.TrimSpace(headerValue))
+	}
+	return headers, nil
+}
+
+// Parses a -since value given as an RFC3339 time, a date or an age relative to now
+func parseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	if since, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return since, nil
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -since value %q: want an RFC3339 time, a date or a duration", value)
+}
+
+// Splits a comma-separated flag value, dropping blanks around and between items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Creates the logger for a run, writing text or JSON to stderr and -log-file at
+// the configured level
+func newLogger(config *Config) *slog.Logger {
+	options := &slog.HandlerOptions{Level: config.LogLevel}
+	var output io.Writer = os.Stderr
+	if config.LogFile != "" { // Bounded on disk for scheduled runs
+		logFile := &lumberjack.Logger{
+			Filename:   config.LogFile,
+			MaxSize:    config.LogMaxSizeMB,
+			MaxBackups: config.LogMaxBackups,
+		}
+		output = io.MultiWriter(os.Stderr, logFile)
+		if config.LogFileOnly {
+			output = logFile
+		}
+	}
+	if config.LogJSON {
+		return slog.New(slog.NewJSONHandler(output, options))
+	}
+	return slog.New(slog.NewTextHandler(output, options))
+}
+
+// Reads a -proxies file of proxy URLs, ignoring blank lines and "#" comments
+func loadProxies(path string) ([]*url.URL, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var proxies []*url.URL
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxyURL, err := parseProxyURL(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		proxies = append(proxies, proxyURL)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("%s: no proxy URLs", path)
+	}
+	return proxies, nil
+}
+
+// Parses and checks a single proxy URL
+func parseProxyURL(rawProxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawProxy) // Parse the proxy address
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", rawProxy, err)
+	}
+	switch proxyURL.Scheme { // Only schemes understood by both net/http and Chrome
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: unsupported scheme %q", rawProxy, proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", rawProxy)
+	}
+	return proxyURL, nil
+}
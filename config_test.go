@@ -0,0 +1,27 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{"200", []int{200}, false},
+		{"200, 203,206", []int{200, 203, 206}, false},
+		{"abc", nil, true},
+		{"99", nil, true},
+		{"600", nil, true},
+		{"", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseStatusCodes(test.value)
+		if (err != nil) != test.wantErr || !slices.Equal(got, test.want) {
+			t.Errorf("parseStatusCodes(%q) = %v, %v; want %v, error %v", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Finding identical files
+)
+
+// Written into the output directory by -dedupe-by-content
+const duplicatesFilename = "duplicates.csv"
+
+// Runs the -dedupe-by-content pass over the output directory and lists every
+// duplicate it found in duplicates.csv, with what was done to it
+func dedupeOutput(downloader *sds.Downloader, action sds.DedupeAction, path string) error {
+	duplicates, distinct, err := downloader.DedupeByContent(action)
+	if writeErr := writeDuplicates(path, duplicates, action); err == nil { // Recorded even after a failure, as those files were already handled
+		err = writeErr
+	}
+	slog.Info("Deduplicated files by content", "action", action, "duplicates", len(duplicates), "distinct", distinct, "path", path)
+	return err
+}
+
+// Writes the duplicates as CSV rows of path, kept_as, sha256, size and action
+func writeDuplicates(path string, duplicates []sds.Duplicate, action sds.DedupeAction) error {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"path", "kept_as", "sha256", "size", "action"})
+	for _, duplicate := range duplicates {
+		writer.Write([]string{duplicate.Path, duplicate.KeptAs, duplicate.SHA256, strconv.FormatInt(duplicate.Size, 10), string(action)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
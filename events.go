@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Failure kinds
+)
+
+// Lifecycle events written by -events
+const (
+	eventResolveStart  = "resolve-start"  // The browser starts on a source URL
+	eventResolveDone   = "resolve-done"   // The source URL resolved
+	eventDownloadStart = "download-start" // The download of a resolved URL starts
+	eventDownloadDone  = "download-done"  // The download finished, saved or skipped
+	eventSkipped       = "skipped"        // The URL won't be downloaded, e.g. filtered or already present
+	eventError         = "error"          // Resolving or downloading failed
+)
+
+// One line of the -events stream
+type event struct {
+	Time        time.Time `json:"time"`                       // When it happened
+	Event       string    `json:"event"`                      // One of the event names above
+	SourceURL   string    `json:"source_url"`                 // URL from the input list
+	ResolvedURL string    `json:"resolved_url,omitempty"`     // URL after following redirects
+	Stage       string    `json:"stage,omitempty"`            // resolve or download, for errors
+	Status      string    `json:"status,omitempty"`           // Download status, e.g. downloaded or skipped
+	Path        string    `json:"path,omitempty"`             // File the PDF was saved to
+	Bytes       int64     `json:"bytes,omitempty"`            // Number of bytes written
+	Reason      string    `json:"reason,omitempty"`           // Why the URL was skipped
+	Error       string    `json:"error,omitempty"`            // Why the URL failed
+	ErrorKind   string    `json:"error_kind,omitempty"`       // Category of the failure, e.g. network or blocked
+	Seconds     float64   `json:"duration_seconds,omitempty"` // Time the finished stage took
+}
+
+// Writes -events as newline-delimited JSON, one line per event. A nil stream
+// drops everything, so callers needn't check whether -events is set.
+type eventStream struct {
+	mu      sync.Mutex    // Keeps concurrent lines from interleaving
+	encoder *json.Encoder // Writes one object per line
+}
+
+// Creates a stream writing to out
+func newEventStream(out io.Writer) *eventStream {
+	return &eventStream{encoder: json.NewEncoder(out)}
+}
+
+// Writes one event, stamping it with the current time
+func (stream *eventStream) emit(entry event) {
+	if stream == nil {
+		return
+	}
+	entry.Time = time.Now().UTC()
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.encoder.Encode(entry) // A broken pipe must not stop the run
+}
+
+// Writes the error event of a failed stage
+func (stream *eventStream) emitError(stage string, outcome urlOutcome, err error, took time.Duration) {
+	stream.emit(event{
+		Event:       eventError,
+		SourceURL:   outcome.Source,
+		ResolvedURL: outcome.Resolved,
+		Stage:       stage,
+		Error:       err.Error(),
+		ErrorKind:   string(sds.ErrorKindOf(err)),
+		Seconds:     took.Seconds(),
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Resolving and HEAD requests
+)
+
+// Verdicts of -head-check
+const (
+	verdictHealthy    = "healthy"    // Answered 2xx at the URL itself
+	verdictRedirected = "redirected" // Answered 2xx after HTTP redirects
+	verdictBroken     = "broken"     // Failed to resolve, failed to answer or answered with an error status
+	verdictSkipped    = "skipped"    // Disallowed by robots.txt or -allow-hosts/-deny-hosts, so not checked
+)
+
+// Counts of URLs by -head-check verdict
+type headCheckTotals struct {
+	mu       sync.Mutex     // Guards counts and writes to out
+	out      io.Writer      // Where the per-URL lines go
+	counts   map[string]int // Verdict → number of URLs
+	finished int            // URLs checked so far
+}
+
+// Resolves every URL and checks where it leads without downloading anything,
+// using as many workers as -resolve-workers. Prints a tab-separated line per
+// URL to out: source, verdict, HTTP status, Content-Type, Content-Length and
+// the URL that answered ("-" where unknown).
+func runHeadCheck(ctx context.Context, config *Config, downloader *sds.Downloader, urls []string, out io.Writer) *headCheckTotals {
+	totals := &headCheckTotals{out: out, counts: make(map[string]int)}
+	sources := make(chan string)
+	var workers sync.WaitGroup
+	for range max(config.ResolveWorkers, 1) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for sourceURL := range sources {
+				result, skipped := headCheckURL(ctx, config, downloader, sourceURL)
+				totals.add(sourceURL, result, skipped)
+			}
+		}()
+	}
+	for _, sourceURL := range urls {
+		if ctx.Err() != nil { // Stop picking up new work once interrupted
+			break
+		}
+		sources <- sourceURL
+	}
+	close(sources)
+	workers.Wait()
+	return totals
+}
+
+// Resolves one source URL and checks the result, honoring robots.txt and the
+// host filters like a real run. Returns nil for a URL that failed before any
+// response, and reports whether the URL was skipped instead.
+func headCheckURL(ctx context.Context, config *Config, downloader *sds.Downloader, sourceURL string) (*sds.HeadResult, bool) {
+	if !downloader.Allowed(ctx, sourceURL) {
+		slog.Warn("Skipping URL disallowed by robots.txt", "url", sourceURL)
+		return nil, true
+	}
+	resolvedURL, err := downloader.Resolve(ctx, sourceURL)
+	if err != nil {
+		slog.Warn("Failed to resolve URL", "url", sourceURL, "kind", sds.ErrorKindOf(err), "error", err)
+		return nil, false
+	}
+	if ok, reason := config.Hosts.permits(resolvedURL); !ok {
+		slog.Debug("Skipping filtered host", "url", resolvedURL, "source", sourceURL, "reason", reason)
+		return nil, true
+	}
+	if !downloader.Allowed(ctx, resolvedURL) { // The redirect target may live on another site
+		slog.Warn("Skipping URL disallowed by robots.txt", "url", resolvedURL, "source", sourceURL)
+		return nil, true
+	}
+	result, err := downloader.HeadCheck(ctx, resolvedURL)
+	if err != nil {
+		slog.Warn("Failed to check URL", "url", resolvedURL, "source", sourceURL, "kind", sds.ErrorKindOf(err), "error", err)
+		return nil, false
+	}
+	return &result, false
+}
+
+// Records and prints the check of one source URL
+func (totals *headCheckTotals) add(sourceURL string, result *sds.HeadResult, skipped bool) {
+	verdict, status, contentType, length, checkedURL := verdictBroken, "-", "-", "-", "-"
+	if skipped {
+		verdict = verdictSkipped
+	}
+	if result != nil {
+		status, checkedURL = strconv.Itoa(result.StatusCode), result.FinalURL
+		if result.ContentType != "" {
+			contentType = result.ContentType
+		}
+		if result.ContentLength >= 0 {
+			length = strconv.FormatInt(result.ContentLength, 10)
+		}
+		switch {
+		case result.StatusCode < 200 || result.StatusCode > 299:
+		case result.Redirected():
+			verdict = verdictRedirected
+		default:
+			verdict = verdictHealthy
+		}
+	}
+	totals.mu.Lock()
+	defer totals.mu.Unlock()
+	totals.counts[verdict]++
+	totals.finished++
+	fmt.Fprintf(totals.out, "%s\t%s\t%s\t%s\t%s\t%s\n", sourceURL, verdict, status, contentType, length, checkedURL)
+}
+
+// Prints how many URLs got each verdict
+func (totals *headCheckTotals) print(out io.Writer) {
+	totals.mu.Lock()
+	defer totals.mu.Unlock()
+	fmt.Fprintf(out, "Head check of %d URLs: %d %s, %d %s, %d %s, %d %s\n", totals.finished,
+		totals.counts[verdictHealthy], verdictHealthy,
+		totals.counts[verdictRedirected], verdictRedirected,
+		totals.counts[verdictBroken], verdictBroken,
+		totals.counts[verdictSkipped], verdictSkipped)
+}
+
+// Reports whether any URL is broken
+func (totals *headCheckTotals) failed() bool {
+	totals.mu.Lock()
+	defer totals.mu.Unlock()
+	return totals.counts[verdictBroken] > 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Restricts downloads to allowed hosts and away from denied ones. An entry matches
+// its own host and every subdomain, so "citgo.com" also covers "www.docs.citgo.com".
+type hostFilter struct {
+	allow []string // If non-empty, only matching hosts are downloaded
+	deny  []string // Matching hosts are never downloaded
+}
+
+// Reports whether rawURL may be downloaded, and if not, why
+func (filter hostFilter) permits(rawURL string) (bool, string) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false, "unparsable URL"
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	if matchesHost(host, filter.deny) {
+		return false, "host is in -deny-hosts"
+	}
+	if len(filter.allow) > 0 && !matchesHost(host, filter.allow) {
+		return false, "host is not in -allow-hosts"
+	}
+	return true, ""
+}
+
+// Reports whether host equals one of the entries or is a subdomain of one
+func matchesHost(host string, entries []string) bool {
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimPrefix(entry, "."))
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
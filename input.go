@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // URL validation
+)
+
+// Reads newline-delimited URLs, ignoring blank lines, "#" comments and invalid URLs
+func readURLs(reader io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text()) // Drop surrounding whitespace
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue // Skip blank lines and comments
+		}
+		if !sds.IsURLValid(line) {
+			slog.Warn("Skipping invalid URL", "url", line)
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// Reports whether stdin is fed by a pipe or file rather than an interactive terminal
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// Returns the URLs to process: from stdin for "-" or piped input, from a file when a
+// path is given, and the built-in list otherwise. Input without a single valid
+// URL is an error, so an empty pipe doesn't pass for a finished run.
+func loadURLs(source string, builtin []string) ([]string, error) {
+	var urls []string
+	var err error
+	switch {
+	case source == "-" || (source == "" && stdinIsPiped()):
+		source = "stdin"
+		urls, err = readURLs(os.Stdin)
+	case source != "":
+		file, openErr := os.Open(source)
+		if openErr != nil {
+			return nil, openErr
+		}
+		defer file.Close()
+		urls, err = readURLs(file)
+	default:
+		return builtin, nil
+	}
+	if err == nil && len(urls) == 0 {
+		err = fmt.Errorf("no valid URLs in %s", source)
+	}
+	return urls, err
+}
+
+// Default -csv column names; the code and language columns are optional under these names
+const (
+	defaultCSVURLColumn  = "url"
+	defaultCSVCodeColumn = "code"
+	defaultCSVLangColumn = "lang"
+)
+
+// Name template used with -csv unless -name-template is given, e.g. "c10005b_en.pdf"
+const defaultCSVNameTemplate = "{{.Code}}_{{.Lang}}"
+
+// Columns of a -csv input, each a header name or a 1-based column number
+type csvColumns struct {
+	URL  string // Column with the URL to fetch
+	Code string // Column with the product code used for naming ("" for none)
+	Lang string // Column with the SDS language ("" for none)
+}
+
+// A URL read from a -csv input, with what its row says about it
+type csvRow struct {
+	URL  string         // URL to fetch
+	Info sds.SourceInfo // Product code and language from the row
+}
+
+// Reads the URLs of a CSV file, or of stdin for "-", with their metadata
+func loadCSV(source string, columns csvColumns) ([]csvRow, error) {
+	if source == "-" {
+		return readCSV(os.Stdin, columns)
+	}
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	rows, err := readCSV(file, columns)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return rows, nil
+}
+
+// Reads CSV rows, skipping a header row, "#" comments and rows whose URL is
+// invalid. The first row counts as a header when its URL cell isn't a URL.
+func readCSV(reader io.Reader, columns csvColumns) ([]csvRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = -1 // Short rows just lack the optional cells
+	records, err := csvReader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	header := records[0]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // Byte order mark of spreadsheet exports
+	}
+	urlIndex, err := csvColumnIndex(header, columns.URL, "", "-csv-url-column")
+	if err != nil {
+		return nil, err
+	}
+	codeIndex, err := csvColumnIndex(header, columns.Code, defaultCSVCodeColumn, "-csv-code-column")
+	if err != nil {
+		return nil, err
+	}
+	langIndex, err := csvColumnIndex(header, columns.Lang, defaultCSVLangColumn, "-csv-lang-column")
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []csvRow
+	for line, record := range records {
+		rawURL := csvCell(record, urlIndex)
+		if line == 0 && !sds.IsURLValid(rawURL) {
+			continue // Header row
+		}
+		if !sds.IsURLValid(rawURL) {
+			slog.Warn("Skipping invalid URL", "url", rawURL, "row", line+1)
+			continue
+		}
+		info := sds.SourceInfo{Code: csvCell(record, codeIndex), Lang: csvCell(record, langIndex)}
+		rows = append(rows, csvRow{URL: rawURL, Info: info})
+	}
+	return rows, nil
+}
+
+// Returns the index of the column spec names, a 1-based number or a header
+// name matched case-insensitively, or -1 for none. A missing name is an error
+// unless it is optional, the column's default.
+func csvColumnIndex(header []string, spec, optional, flagName string) (int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return -1, nil
+	}
+	if number, err := strconv.Atoi(spec); err == nil {
+		if number < 1 {
+			return 0, fmt.Errorf("invalid %s %d: columns are numbered from 1", flagName, number)
+		}
+		return number - 1, nil
+	}
+	for index, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), spec) {
+			return index, nil
+		}
+	}
+	if spec == optional {
+		return -1, nil
+	}
+	return 0, fmt.Errorf("no column named %q in the header row (set %s)", spec, flagName)
+}
+
+// Returns the trimmed cell at index of record, or "" if the row is too short
+func csvCell(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+// Hands the metadata of each CSV row to the downloader for naming, keeping the
+// first row of a repeated URL, and returns the URLs along with a function
+// telling a URL's SDS language from its row or, failing that, from the URL
+func describeCSVRows(downloader *sds.Downloader, rows []csvRow) ([]string, func(string) string) {
+	urls := make([]string, 0, len(rows))
+	languages := make(map[string]string, len(rows)) // URL → language from its row
+	described := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		rowURL := downloader.StripCredentials(row.URL) // Credentials stay out of logs and reports
+		urls = append(urls, rowURL)
+		if described[rowURL] {
+			continue
+		}
+		described[rowURL] = true
+		downloader.Describe(rowURL, row.Info)
+		if language := row.Info.Lang; language != "" {
+			// "EN", or "US_EN" in the style of a spheracloud searchvalue
+			languages[rowURL] = strings.ToUpper(language[strings.LastIndexAny(language, "_-")+1:])
+		}
+	}
+	languageOf := func(rawURL string) string {
+		if language, ok := languages[rawURL]; ok {
+			return language
+		}
+		return sds.SDSLanguage(rawURL)
+	}
+	return urls, languageOf
+}
+
+// Returns the links on a seed page that match pattern, honoring its robots.txt
+func scrapeSeed(ctx context.Context, downloader *sds.Downloader, seedURL string, pattern *regexp.Regexp) ([]string, error) {
+	if !downloader.Allowed(ctx, seedURL) {
+		return nil, errors.New("disallowed by robots.txt")
+	}
+	links, err := downloader.ScrapeLinks(ctx, seedURL, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		slog.Warn("No links on the seed page matched -seed-pattern", "url", seedURL, "pattern", pattern)
+	}
+	return links, nil
+}
+
+// Removes repeated URLs, keeping the first occurrence of each in order
+func dedupeURLs(urls []string) []string {
+	seen := make(map[string]bool, len(urls))
+	unique := make([]string, 0, len(urls))
+	for _, rawURL := range urls {
+		if seen[rawURL] {
+			continue
+		}
+		seen[rawURL] = true
+		unique = append(unique, rawURL)
+	}
+	return unique
+}
+
+// Keeps the URLs whose SDS language, as told by languageOf, is one of languages
+// ("EN", "ES", ...); an empty list or "all" keeps everything. URLs without a
+// language are kept unless excludeUnknown is set.
+func filterLanguages(urls, languages []string, excludeUnknown bool, languageOf func(string) string) []string {
+	wanted := make(map[string]bool, len(languages))
+	for _, language := range languages {
+		wanted[strings.ToUpper(language)] = true
+	}
+	if len(wanted) == 0 || wanted["ALL"] {
+		if !excludeUnknown {
+			return urls
+		}
+		wanted = nil // Any known language passes
+	}
+	kept := make([]string, 0, len(urls))
+	for _, rawURL := range urls {
+		language := languageOf(rawURL)
+		switch {
+		case language == "" && excludeUnknown:
+		case language == "", wanted == nil, wanted[language]:
+			kept = append(kept, rawURL)
+		}
+	}
+	if skipped := len(urls) - len(kept); skipped > 0 {
+		slog.Info("Skipped URLs in other languages", "skipped", skipped, "languages", languages)
+	}
+	return kept
+}
+
+// Truncates urls to the first limit entries; zero or negative means no limit
+func limitURLs(urls []string, limit int) []string {
+	if limit > 0 && limit < len(urls) {
+		return urls[:limit]
+	}
+	return urls
+}
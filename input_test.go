@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds"
+)
+
+func TestFilterLanguages(t *testing.T) {
+	const (
+		english = "https://apps.spheracloud.net/LoginFetch.aspx?method=FETCHSDS&searchfield=SN&searchvalue=622613001_US_EN"
+		spanish = "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=631310001_mx_es" // Lowercase in the URL
+		french  = "https://apps.spheracloud.net/ViewFetch.aspx?searchvalue=622613001_CA_FR"
+		direct  = "http://www.docs.citgo.com/msds_pi/C10005B.pdf" // No language
+		bare    = "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001"
+	)
+	urls := []string{english, spanish, french, direct, bare}
+	tests := []struct {
+		languages      []string
+		excludeUnknown bool
+		want           []string
+	}{
+		{nil, false, urls},
+		{[]string{"EN"}, false, []string{english, direct, bare}},
+		{[]string{"en", "ES"}, false, []string{english, spanish, direct, bare}},
+		{[]string{"EN"}, true, []string{english}},
+		{[]string{"all"}, false, urls},
+		{[]string{"all"}, true, []string{english, spanish, french}},
+		{nil, true, []string{english, spanish, french}},
+		{[]string{"DE"}, true, []string{}},
+	}
+	for _, test := range tests {
+		got := filterLanguages(urls, test.languages, test.excludeUnknown, sds.SDSLanguage)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("filterLanguages(%v, exclude unknown %v) = %v, want %v", test.languages, test.excludeUnknown, got, test.want)
+		}
+	}
+}
+
+func TestLoadURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string // nil when loading fails
+	}{
+		{"urls", "# CITGO\nhttp://www.docs.citgo.com/msds_pi/C10005B.pdf\n\n  http://www.docs.citgo.com/msds_pi/C10139.pdf  \n", []string{
+			"http://www.docs.citgo.com/msds_pi/C10005B.pdf", "http://www.docs.citgo.com/msds_pi/C10139.pdf",
+		}},
+		{"empty", "", nil},
+		{"only comments and invalid lines", "# nothing yet\n\nnot a url\n", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "urls.txt")
+			if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadURLs(path, []string{"http://builtin.example/sds.pdf"})
+			if test.want == nil {
+				if err == nil {
+					t.Errorf("loaded %v, want an error for a list without URLs", got)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, test.want) {
+				t.Errorf("loaded %v (error %v), want %v", got, err, test.want)
+			}
+		})
+	}
+}
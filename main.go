@@ -1,274 +1,132 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"io"
+	"errors"
+	"fmt"
 	"log"
-	"net/http"
-	"net/url"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
-	"strings"
-	"time"
+	"runtime"
+	"syscall"
 
-	"github.com/chromedp/chromedp" // External package to control Chrome/Chromium browser
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Resolving and downloading SDS PDFs
 )
 
-// It checks if the file exists
-// If the file exists, it returns true
-// If the file does not exist, it returns false
-func fileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if err != nil {
-		return false
-	}
-	return !info.IsDir()
-}
+// Cause of the run's cancellation when -fail-fast stops it
+var errFailFast = errors.New("stopped by -fail-fast")
 
-// Remove a file from the file system
-func removeFile(path string) {
-	err := os.Remove(path)
-	if err != nil {
-		log.Println(err)
-	}
-}
+// Files written into the output directory next to the PDFs
+const (
+	checksumsFilename = "sha256sums.txt" // Written with -sha256sums
+	manifestFilename  = "manifest.csv"   // Read by verify when -manifest is not given
+)
 
-// Checks whether a given directory exists
-func directoryExists(path string) bool {
-	directory, err := os.Stat(path) // Get info for the path
-	if err != nil {
-		return false // Return false if error occurs
+// Prints one tab-separated dry-run line: source URL, resolved URL, output path and
+// whether that path already exists ("exists") or would be written ("new")
+func printDryRun(downloader *sds.Downloader, sourceURL, resolvedURL string) {
+	if !sds.IsURLValid(resolvedURL) {
+		fmt.Printf("%s\t-\t-\tunresolved\n", sourceURL)
+		return
 	}
-	return directory.IsDir() // Return true if it's a directory
-}
-
-// Creates a directory at given path with provided permissions
-func createDirectory(path string, permission os.FileMode) {
-	err := os.Mkdir(path, permission) // Attempt to create directory
-	if err != nil {
-		log.Println(err) // Log error if creation fails
+	filePath := downloader.OutputPath(resolvedURL)
+	state := "new"
+	if sds.FileExists(filePath) {
+		state = "exists"
 	}
+	fmt.Printf("%s\t%s\t%s\t%s\n", sourceURL, resolvedURL, filePath, state)
 }
 
-// Verifies whether a string is a valid URL format
-func isUrlValid(uri string) bool {
-	_, err := url.ParseRequestURI(uri) // Try parsing the URL
-	return err == nil                  // Return true if valid
-}
-
-// Extracts filename from full path (e.g. "/dir/file.pdf" → "file.pdf")
-func getFilename(path string) string {
-	return filepath.Base(path) // Use Base function to get file name only
-}
-
-// Removes all instances of a specific substring from input string
-func removeSubstring(input string, toRemove string) string {
-	result := strings.ReplaceAll(input, toRemove, "") // Replace substring with empty string
-	return result
-}
-
-// Gets the file extension from a given file path
-func getFileExtension(path string) string {
-	return filepath.Ext(path) // Extract and return file extension
-}
-
-// Converts a raw URL into a sanitized PDF filename safe for filesystem
-func urlToFilename(rawURL string) string {
-	lower := strings.ToLower(rawURL) // Convert URL to lowercase
-	lower = getFilename(lower)       // Extract filename from URL
-
-	reNonAlnum := regexp.MustCompile(`[^a-z0-9]`)   // Regex to match non-alphanumeric characters
-	safe := reNonAlnum.ReplaceAllString(lower, "_") // Replace non-alphanumeric with underscores
-
-	safe = regexp.MustCompile(`_+`).ReplaceAllString(safe, "_") // Collapse multiple underscores into one
-	safe = strings.Trim(safe, "_")                              // Trim leading and trailing underscores
-
-	var invalidSubstrings = []string{
-		"_pdf", // Substring to remove from filename
-	}
-
-	for _, invalidPre := range invalidSubstrings { // Remove unwanted substrings
-		safe = removeSubstring(safe, invalidPre)
+// Logs the outcome of a download at a level matching its importance; successes
+// are debug-only because the progress line already reports them at info
+func logResult(result sds.Result, err error) {
+	switch {
+	case err != nil:
+		slog.Warn("Download failed", "url", result.URL, "kind", sds.ErrorKindOf(err), "error", err)
+	case result.Status == sds.StatusSkipped:
+		slog.Debug("Skipped download (existing, unchanged or older than -since)", "url", result.URL, "path", result.Path)
+	case result.Replaced:
+		slog.Debug("Overwrote existing file", "bytes", result.Bytes, "url", result.URL, "path", result.Path)
+	default:
+		slog.Debug("Successfully downloaded", "bytes", result.Bytes, "url", result.URL, "path", result.Path)
 	}
-
-	if getFileExtension(safe) != ".pdf" { // Ensure file ends with .pdf
-		safe = safe + ".pdf"
-	}
-
-	return safe // Return sanitized filename
 }
 
-// Downloads a PDF from given URL and saves it in the specified directory
-func downloadPDF(finalURL, outputDir string) bool {
-	filename := strings.ToLower(urlToFilename(finalURL)) // Sanitize the filename
-	filePath := filepath.Join(outputDir, filename)       // Construct full path for output file
-
-	if fileExists(filePath) { // Skip if file already exists
-		log.Printf("File already exists, skipping: %s", filePath)
-		return false
-	}
-
-	client := &http.Client{Timeout: 15 * time.Minute} // Create HTTP client with timeout
-
-	// Create a new request so we can set headers
-	req, err := http.NewRequest("GET", finalURL, nil)
-	if err != nil {
-		log.Printf("Failed to create request for %s: %v", finalURL, err)
-		return false
-	}
-
-	// Set a User-Agent header
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36")
-
-	// Send the request
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Failed to download %s: %v", finalURL, err)
-		return false
-	}
-	defer resp.Body.Close() // Ensure response body is closed
-
-	if resp.StatusCode != http.StatusOK { // Check if response is 200 OK
-		log.Printf("Download failed for %s: %s", finalURL, resp.Status)
-		return false
-	}
-
-	contentType := resp.Header.Get("Content-Type") // Get content type of response
-	if !strings.Contains(contentType, "binary/octet-stream") &&
-		!strings.Contains(contentType, "application/pdf") {
-		log.Printf("Invalid content type for %s: %s (expected PDF)", finalURL, contentType)
-		return false
-	}
-
-	var buf bytes.Buffer                     // Create a buffer to hold response data
-	written, err := io.Copy(&buf, resp.Body) // Copy data into buffer
-	if err != nil {
-		log.Printf("Failed to read PDF data from %s: %v", finalURL, err)
-		return false
-	}
-	if written == 0 { // Skip empty files
-		log.Printf("Downloaded 0 bytes for %s; not creating file", finalURL)
-		return false
-	}
-
-	out, err := os.Create(filePath) // Create output file
+func main() {
+	config, err := parseConfig() // Read settings from command line flags
 	if err != nil {
-		log.Printf("Failed to create file for %s: %v", finalURL, err)
-		return false
+		log.Fatalln(err)
 	}
-	defer out.Close() // Ensure file is closed after writing
+	slog.SetDefault(newLogger(config)) // Route all logging through the leveled logger
 
-	if _, err := buf.WriteTo(out); err != nil { // Write buffer contents to file
-		log.Printf("Failed to write PDF to file for %s: %v", finalURL, err)
-		return false
+	if config.WorkersAuto { // Printed whatever the log level, as the counts shape the whole run
+		available, _ := availableMemory()
+		fmt.Fprintf(os.Stderr, "-workers auto: %d resolve workers, %d download workers (%d CPUs, %d MiB available)\n",
+			config.ResolveWorkers, config.DownloadWorkers, runtime.NumCPU(), available>>20)
 	}
 
-	log.Printf("Successfully downloaded %d bytes: %s → %s", written, finalURL, filePath) // Log success
-	return true
-}
-
-// extractBaseDomain takes a URL string and returns only the bare domain name
-// without any subdomains or suffixes (e.g., ".com", ".org", ".co.uk").
-func extractBaseDomain(inputUrl string) string {
-	// Parse the input string into a structured URL object
-	parsedUrl, parseError := url.Parse(inputUrl)
-
-	// If parsing fails, log the error and return an empty string
-	if parseError != nil {
-		log.Println("Error parsing URL:", parseError)
-		return ""
-	}
-
-	// Extract the hostname (e.g., "sub.example.com")
-	hostName := parsedUrl.Hostname()
-
-	// Split the hostname into parts separated by "."
-	// For example: "sub.example.com" -> ["sub", "example", "com"]
-	parts := strings.Split(hostName, ".")
-
-	// If there are at least 2 parts, the second last part is usually the domain
-	// Example: "sub.example.com" -> "example"
-	//          "blog.my-site.co.uk" -> "my-site"
-	if len(parts) >= 2 {
-		return parts[len(parts)-2]
+	if config.VerifyMirror { // Check an existing mirror instead of downloading
+		result, err := verifyMirror(os.Stdout, config.OutputDir, config.ManifestPath, config.VerifyHash)
+		if err != nil {
+			slog.Error("Failed to verify output directory", "path", config.OutputDir, "manifest", config.ManifestPath, "error", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Verified %d files: %d missing, %d corrupt, %d extra, %d unknown\n", result.Checked, result.Missing, result.Corrupt, result.Extra, result.Unknown)
+		if result.failed() {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// If splitting fails or domain structure is unusual, return the hostname itself
-	return hostName
-}
-
-// getFinalURL navigates to a given URL using headless Chrome
-// and follows all redirects (HTTP, meta refresh, JS) until the URL stabilizes.
-func getFinalURL(inputURL string) string {
-	// Configure Chrome options
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true), // Run headless
-		chromedp.Flag("no-sandbox", true),
-		chromedp.Flag("disable-gpu", true),
-	)
-
-	// Create allocator context
-	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancelAlloc()
-
-	// Context with timeout
-	ctx, cancel := context.WithTimeout(allocCtx, 2*time.Minute)
-	defer cancel()
-
-	// New browser tab context
-	ctx, cancelCtx := chromedp.NewContext(ctx)
-	defer cancelCtx()
-
-	var currentURL, lastURL string
-	start := time.Now()
-
-	for {
-		// Navigate and capture URL
-		err := chromedp.Run(ctx,
-			chromedp.Navigate(inputURL),
-			chromedp.WaitReady("body", chromedp.ByQuery),
-			chromedp.Sleep(3*time.Second), // let JS/meta redirects fire
-			chromedp.Location(&currentURL),
-		)
+	if config.ClearCache { // Every URL goes back to the browser, e.g. after the sites moved their documents
+		removed, err := sds.ClearResolveCache(config.OutputDir)
 		if err != nil {
-			log.Println(err)
-			return ""
+			slog.Error("Failed to clear resolve cache", "path", config.OutputDir, "error", err)
+			os.Exit(1)
 		}
-
-		// Stop if URL has stabilized
-		if currentURL == lastURL {
-			return currentURL
+		if config.ClearCacheOnly {
+			fmt.Fprintf(os.Stderr, "Cleared %d cached resolutions\n", removed)
+			return
 		}
+		slog.Info("Cleared resolve cache", "path", config.OutputDir, "entries", removed)
+	}
 
-		// Prepare for next loop
-		lastURL = currentURL
-		inputURL = currentURL
+	if config.Insecure { // Loud on purpose, whatever the log level
+		fmt.Fprintln(os.Stderr, "WARNING: -insecure disables TLS certificate verification; never use it outside trusted internal networks")
+	}
 
-		// Safety cutoff
-		if time.Since(start) > (3 * time.Minute) {
-			log.Printf("redirect loop timeout at: %s", currentURL)
-			return currentURL
-		}
+	// Cancel in-flight work on Ctrl-C or SIGTERM instead of dying mid-download
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if config.TimeoutTotal > 0 { // Hard ceiling for the whole run, e.g. in CI
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.TimeoutTotal)
+		defer cancel()
 	}
-}
+	ctx, cancelRun := context.WithCancelCause(ctx) // Lets -fail-fast stop everything in flight
+	defer cancelRun(nil)
 
-func main() {
-	outputDir := "PDFs/" // Directory to store downloaded PDFs
+	outputDir := config.OutputDir // Directory to store downloaded PDFs
 
-	if !directoryExists(outputDir) { // Check if directory exists
-		createDirectory(outputDir, 0o755) // Create directory with read-write-execute permissions
+	if !config.DryRun { // Create the directory (and any parents) with read-write-execute permissions
+		if err := sds.CreateDirectory(outputDir, 0o755); err != nil {
+			slog.Error("Failed to create output directory", "path", outputDir, "error", err)
+			os.Exit(1)
+		}
 	}
 
 	// The remote domain name.
 	remoteDomainName := "https://beaumontproductsingredients.com"
 
 	// The location to the local.
-	localFile := extractBaseDomain(remoteDomainName) + ".html"
+	localFile := sds.ExtractBaseDomain(remoteDomainName) + ".html"
 	// Check if the local file exists.
-	if fileExists(localFile) {
-		removeFile(localFile)
+	if sds.FileExists(localFile) {
+		if err := sds.RemoveFile(localFile); err != nil {
+			slog.Warn("Failed to remove file", "path", localFile, "error", err)
+		}
 	}
 	// The location to the remote url.
 	remoteURL := []string{
@@ -904,12 +762,182 @@ func main() {
 		"https://apps.spheracloud.net/LoginFetch.aspx?userid=7EEpJ1QmzKUA&companyid=37NzIg6inj0A&method=FETCHSDS&searchfield=SN&searchvalue=633794001_US_EN",
 		"https://apps.spheracloud.net/LoginFetch.aspx?userid=7EEpJ1QmzKUA&companyid=37NzIg6inj0A&method=FETCHSDS&searchfield=SN&searchvalue=633794001_MX_ES",
 	}
-	// Loop through all extracted PDF URLs
-	for _, urls := range remoteURL {
-		// Get final resolved URL (in case of redirects)
-		resolvedPDFURL := getFinalURL(urls)
-		if isUrlValid(resolvedPDFURL) { // Check if the final URL is valid
-			downloadPDF(resolvedPDFURL, outputDir) // Download the PDF
+	downloader := sds.New(config.Config) // Shared downloader for the whole run
+
+	if !config.DryRun { // Refuse to start a batch that can't finish
+		if err := downloader.CheckFreeSpace(outputDir, 0); err != nil {
+			slog.Error("Not starting downloads", "path", outputDir, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if config.Seed != "" { // The seed page's links replace the built-in list
+		remoteURL = nil
+	}
+	languageOf := sds.SDSLanguage // Language of a URL for -lang
+	if config.CSVSource != "" {
+		rows, err := loadCSV(config.CSVSource, config.CSVColumns)
+		if err != nil {
+			slog.Error("Failed to read URL list", "source", config.CSVSource, "error", err)
+			os.Exit(1)
+		}
+		remoteURL, languageOf = describeCSVRows(downloader, rows)
+	} else if remoteURL, err = loadURLs(config.URLSource, remoteURL); err != nil { // Allow the list to come from a file or stdin
+		slog.Error("Failed to read URL list", "source", config.URLSource, "error", err)
+		os.Exit(1)
+	}
+	for index, rawURL := range remoteURL { // Keep "user:pass@" out of logs, reports and state files
+		remoteURL[index] = downloader.StripCredentials(rawURL)
+	}
+	if config.Seed != "" {
+		config.Seed = downloader.StripCredentials(config.Seed)
+		seedLinks, err := scrapeSeed(ctx, downloader, config.Seed, config.SeedPattern)
+		if err != nil {
+			slog.Error("Failed to scrape seed page", "url", config.Seed, "error", err)
+			downloader.Close()
+			os.Exit(1)
+		}
+		remoteURL = append(remoteURL, seedLinks...)
+	}
+	if config.TagLanguages { // Direct links have a language too
+		tagged := languageOf
+		languageOf = func(rawURL string) string {
+			if language := tagged(rawURL); language != "" {
+				return language
+			}
+			return sds.SuffixLanguage(rawURL)
+		}
+	}
+	// Each URL once and only in the wanted languages
+	remoteURL = filterLanguages(dedupeURLs(remoteURL), config.Languages, config.ExcludeUnknownLang, languageOf)
+	var state *runState // Progress saved for -state, so an interrupted run can resume
+	if config.StatePath != "" && !config.DryRun {
+		if state, err = loadRunState(config.StatePath); err != nil {
+			slog.Error("Failed to read state file", "path", config.StatePath, "error", err)
+			downloader.Close()
+			os.Exit(1)
+		}
+		remoteURL = state.remaining(remoteURL, config.Overwrite)
+	}
+	remoteURL = limitURLs(remoteURL, config.Limit) // At most -limit of them
+
+	if config.ListOnly { // Names come from the URLs alone, so no browser or network is needed
+		if collisions := listFilenames(os.Stdout, os.Stderr, downloader, remoteURL); collisions > 0 {
+			slog.Error("Output filenames collide", "paths", collisions)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if config.HeadCheck { // A health scan of where the URLs lead, downloading nothing
+		totals := runHeadCheck(ctx, config, downloader, remoteURL, os.Stdout)
+		downloader.Close()
+		totals.print(os.Stderr)
+		if totals.failed() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	summary := newRunSummary(downloader.Stats) // Counters for the end-of-run report
+	report := newRunReport()                   // Per-URL outcomes for -report
+	// One line per URL on stderr, shown at -log-level info or lower and never in dry runs
+	progress := newProgressPrinter(os.Stderr, len(remoteURL), config.LogLevel <= slog.LevelInfo && !config.DryRun)
+
+	if config.Archive != "" && !config.DryRun { // Collect the PDFs in a single zip
+		downloader.Archive, err = sds.CreateArchive(config.Archive)
+		if err != nil {
+			slog.Error("Failed to create archive", "path", config.Archive, "error", err)
+			downloader.Close() // The -seed page may have started the browser
+			os.Exit(1)
+		}
+	}
+
+	var events *eventStream // Lifecycle events for -events, nil when off
+	if config.Events != "" {
+		events = newEventStream(os.Stdout)
+	}
+
+	// Resolve and download all the PDF URLs
+	runPipeline(ctx, config, downloader, events, remoteURL, func(outcome urlOutcome) {
+		if outcome.Skip != "" { // Download already counted everything else
+			downloader.Stats.Record(outcome.Result.Status, 0)
+			if outcome.Err == nil { // Failures already had their error event
+				events.emit(event{Event: eventSkipped, SourceURL: outcome.Source, ResolvedURL: outcome.Resolved, Path: outcome.Result.Path, Reason: outcome.Skip})
+			}
+		}
+		progress.reportOutcome(outcome)
+		summary.add(outcome)
+		report.add(outcome)
+		if state != nil {
+			state.record(outcome)
+		}
+		if config.FailFast && outcome.Err != nil && ctx.Err() == nil {
+			slog.Error("Stopping at the first failure (-fail-fast)", "url", outcome.Source, "error", outcome.Err)
+			cancelRun(errFailFast)
+		}
+	})
+
+	downloader.Close() // Shut down the shared browser
+
+	switch {
+	case errors.Is(context.Cause(ctx), errFailFast):
+		slog.Warn("Stopped after a failure before all URLs were processed", "processed", progress.finished(), "total", len(remoteURL))
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		slog.Warn("Stopped at -timeout-total before all URLs were processed", "timeout", config.TimeoutTotal, "processed", progress.finished(), "total", len(remoteURL))
+	case ctx.Err() != nil:
+		slog.Warn("Interrupted before all URLs were processed", "processed", progress.finished(), "total", len(remoteURL))
+	}
+	if config.DryRun { // Nothing was downloaded, so there is nothing to summarize
+		return
+	}
+	if downloader.Archive != nil { // Finish the zip even after an interruption
+		if err := downloader.Archive.Close(); err != nil {
+			slog.Error("Failed to write archive", "path", config.Archive, "error", err)
+			os.Exit(1)
+		}
+	}
+	summary.print(os.Stderr) // Always report, regardless of log level
+	if config.ReportPath != "" {
+		if err := report.write(config.ReportPath); err != nil {
+			slog.Error("Failed to write report", "path", config.ReportPath, "error", err)
+		}
+	}
+	if config.Dedupe != "" { // Before the checksums and manifest, so they list what is left
+		duplicatesPath := filepath.Join(outputDir, duplicatesFilename)
+		if err := dedupeOutput(downloader, config.Dedupe, duplicatesPath); err != nil {
+			slog.Error("Failed to deduplicate files", "path", outputDir, "error", err)
+		}
+	}
+	if config.Checksums && downloader.Archive == nil { // Archives keep no per-file metadata
+		checksumsPath := filepath.Join(outputDir, checksumsFilename)
+		if err := downloader.WriteChecksums(checksumsPath); err != nil {
+			slog.Error("Failed to write checksums", "path", checksumsPath, "error", err)
+		}
+	}
+	if config.ManifestPath != "" && downloader.Archive == nil {
+		write := downloader.WriteManifest
+		if config.ManifestAppend { // Keep earlier runs' rows as history
+			write = func(path string) error { return downloader.AppendManifest(path, summary.started) }
+		}
+		if err := write(config.ManifestPath); err != nil {
+			slog.Error("Failed to write manifest", "path", config.ManifestPath, "error", err)
+		}
+	}
+	if config.MetricsPath != "" {
+		if err := summary.writeMetrics(config.MetricsPath); err != nil {
+			slog.Error("Failed to write metrics", "path", config.MetricsPath, "error", err)
+		}
+	}
+	if downloader.Stats.HasFailures() {
+		os.Exit(1) // Let CI jobs detect a partial run
+	}
+	// Only a run that got through every URL may move the baseline, or the
+	// documents it missed would count as not updated next time
+	if config.SinceFile != "" && ctx.Err() == nil && config.Limit == 0 {
+		if err := writeSinceFile(config.SinceFile, summary.started); err != nil {
+			slog.Error("Failed to write since file", "path", config.SinceFile, "error", err)
+			os.Exit(1)
 		}
 	}
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Writes the run's counters in the Prometheus text exposition format, for the
+// node_exporter textfile collector. The file is replaced atomically so the
+// collector never reads a half-written file.
+func (summary *runSummary) writeMetrics(path string) error {
+	stats := summary.stats
+	metrics := []struct {
+		name, help, kind string
+		value            float64
+	}{
+		{"sds_downloads_total", "PDFs written to disk.", "counter", float64(stats.Downloaded.Load())},
+		{"sds_skipped_total", "URLs skipped because their PDF was already present or filtered out.", "counter", float64(stats.Skipped.Load())},
+		{"sds_failed_total", "URLs that could not be resolved or downloaded as a PDF.", "counter", float64(stats.Failed.Load() + stats.InvalidContentType.Load())},
+		{"sds_bytes_total", "Total size of the PDFs written.", "counter", float64(stats.BytesWritten.Load())},
+		{"sds_run_duration_seconds", "Wall-clock duration of the run.", "gauge", time.Since(summary.started).Seconds()},
+	}
+
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", metric.name, metric.kind)
+		fmt.Fprintf(&buf, "%s %g\n", metric.name, metric.value)
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
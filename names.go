@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Output naming
+)
+
+// Prints one tab-separated "source<TAB>output path" line per URL for -list-only,
+// naming each from the URL alone as nothing is resolved or fetched, then lists
+// the paths more than one URL maps to. Returns how many paths collide.
+func listFilenames(out, errOut io.Writer, downloader *sds.Downloader, urls []string) int {
+	sources := make(map[string][]string) // Output path → URLs that map to it
+	var paths []string                   // Output paths in first-seen order, as first spelled
+	for _, sourceURL := range urls {
+		filePath := downloader.OutputPath(sourceURL)
+		key := strings.ToLower(filePath) // Case-insensitive filesystems merge these too
+		if len(sources[key]) == 0 {
+			paths = append(paths, filePath)
+		}
+		sources[key] = append(sources[key], sourceURL)
+		fmt.Fprintf(out, "%s\t%s\n", sourceURL, filePath)
+	}
+
+	collisions := 0
+	for _, path := range paths {
+		colliding := sources[strings.ToLower(path)]
+		if len(colliding) < 2 {
+			continue
+		}
+		collisions++
+		fmt.Fprintf(errOut, "collision: %d URLs map to %s\n", len(colliding), path)
+		for _, sourceURL := range colliding {
+			fmt.Fprintf(errOut, "  %s\n", sourceURL)
+		}
+	}
+	return collisions
+}
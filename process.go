@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Resolving and downloading SDS PDFs
+)
+
+// What happened to one source URL, from resolving it to saving its PDF
+type urlOutcome struct {
+	Source   string        // URL from the input list
+	Resolved string        // URL after following redirects ("" if resolution failed)
+	Result   sds.Result    // Download result; only Status is set for URLs never downloaded
+	Err      error         // Why the URL failed, if it did
+	Skip     string        // Why the URL was never downloaded (e.g. "filtered"), or ""
+	Started  time.Time     // When work on the URL began
+	Duration time.Duration // Time spent on the URL
+}
+
+// Resolves a single source URL and applies the robots.txt and host filters,
+// reporting whether it should go on to be downloaded. In dry-run mode it prints
+// the planned output instead.
+func resolveURL(ctx context.Context, config *Config, downloader *sds.Downloader, events *eventStream, sourceURL string) (urlOutcome, bool) {
+	outcome := urlOutcome{
+		Source:  sourceURL,
+		Result:  sds.Result{URL: sourceURL, Status: sds.StatusSkipped},
+		Started: time.Now(),
+	}
+
+	if config.OnlyMissing && !config.DryRun { // Spare the browser for files that are already here
+		if filePath := downloader.ExistingOutput(sourceURL); filePath != "" {
+			slog.Debug("Skipping URL whose file exists", "url", sourceURL, "path", filePath)
+			outcome.Result.Path, outcome.Skip = filePath, "present"
+			return outcome, false
+		}
+	}
+	if !downloader.Allowed(ctx, sourceURL) { // Be polite unless -ignore-robots is set
+		slog.Warn("Skipping URL disallowed by robots.txt", "url", sourceURL)
+		outcome.Skip = "disallowed by robots.txt"
+		return outcome, false
+	}
+	// Get final resolved URL (in case of redirects)
+	events.emit(event{Event: eventResolveStart, SourceURL: sourceURL})
+	resolveStart := time.Now()
+	resolvedURL, err := downloader.Resolve(ctx, sourceURL)
+	if err != nil {
+		events.emitError("resolve", outcome, err, time.Since(resolveStart))
+	} else {
+		events.emit(event{Event: eventResolveDone, SourceURL: sourceURL, ResolvedURL: resolvedURL, Seconds: time.Since(resolveStart).Seconds()})
+	}
+	switch {
+	case errors.Is(err, sds.ErrBlocked): // Needs a session or a human, not a retry
+		slog.Warn("Blocked while resolving URL", "url", sourceURL, "error", err)
+	case err != nil:
+		slog.Warn("Failed to resolve URL", "url", sourceURL, "kind", sds.ErrorKindOf(err), "error", err)
+	}
+	if config.ResolveOnly { // Only the resolved URL is wanted
+		if err == nil && sds.IsURLValid(resolvedURL) {
+			fmt.Printf("%s\t%s\n", sourceURL, resolvedURL)
+		}
+		return outcome, false
+	}
+	if config.DryRun { // Report what would happen without downloading
+		printDryRun(downloader, sourceURL, resolvedURL)
+		return outcome, false
+	}
+	if err != nil || !sds.IsURLValid(resolvedURL) { // Check if the final URL is valid
+		if err == nil {
+			err = errors.New("resolved to an invalid URL")
+		}
+		outcome.Result.Status, outcome.Err, outcome.Skip = sds.StatusFailed, err, "unresolved"
+		if errors.Is(err, sds.ErrBlocked) {
+			outcome.Skip = "blocked"
+		}
+		return outcome, false
+	}
+	outcome.Resolved = resolvedURL
+	outcome.Result.URL = resolvedURL
+
+	if ok, reason := config.Hosts.permits(resolvedURL); !ok { // Honor -allow-hosts/-deny-hosts
+		slog.Debug("Skipping filtered host", "url", resolvedURL, "source", sourceURL, "reason", reason)
+		outcome.Skip = "filtered"
+		return outcome, false
+	}
+	if !downloader.Allowed(ctx, resolvedURL) { // The redirect target may live on another site
+		slog.Warn("Skipping URL disallowed by robots.txt", "url", resolvedURL, "source", sourceURL)
+		outcome.Skip = "disallowed by robots.txt"
+		return outcome, false
+	}
+	return outcome, true
+}
+
+// Downloads the PDF of a resolved URL
+func downloadURL(ctx context.Context, downloader *sds.Downloader, events *eventStream, outcome urlOutcome) urlOutcome {
+	events.emit(event{Event: eventDownloadStart, SourceURL: outcome.Source, ResolvedURL: outcome.Resolved})
+	downloadStart := time.Now()
+	outcome.Result, outcome.Err = downloader.Download(ctx, outcome.Resolved) // Download the PDF
+	logResult(outcome.Result, outcome.Err)
+	if outcome.Err != nil {
+		events.emitError("download", outcome, outcome.Err, time.Since(downloadStart))
+	} else {
+		events.emit(event{
+			Event:       eventDownloadDone,
+			SourceURL:   outcome.Source,
+			ResolvedURL: outcome.Resolved,
+			Status:      outcome.Result.Status.String(),
+			Path:        outcome.Result.Path,
+			Bytes:       outcome.Result.Bytes,
+			Seconds:     time.Since(downloadStart).Seconds(),
+		})
+	}
+	return outcome
+}
+
+// Runs the URLs through two stages connected by a channel: a few resolvers, each
+// driving its own Chrome tab, feed a larger pool of downloaders, so the browser
+// keeps working while downloads wait on the network. Every finished URL is
+// passed to finish, which must be safe for concurrent use. Lifecycle events go
+// to events, which may be nil.
+func runPipeline(ctx context.Context, config *Config, downloader *sds.Downloader, events *eventStream, urls []string, finish func(urlOutcome)) {
+	sources := make(chan string)
+	resolved := make(chan urlOutcome, config.DownloadWorkers) // Small buffer so resolvers rarely wait
+	done := func(outcome urlOutcome) {
+		outcome.Duration = time.Since(outcome.Started)
+		finish(outcome)
+	}
+
+	var resolvers sync.WaitGroup
+	for range max(config.ResolveWorkers, 1) {
+		resolvers.Add(1)
+		go func() {
+			defer resolvers.Done()
+			for sourceURL := range sources {
+				if outcome, ok := resolveURL(ctx, config, downloader, events, sourceURL); ok {
+					resolved <- outcome
+				} else if !config.DryRun { // Dry runs print their own line and record nothing
+					done(outcome)
+				}
+			}
+		}()
+	}
+
+	var downloaders sync.WaitGroup
+	for range max(config.DownloadWorkers, 1) {
+		downloaders.Add(1)
+		go func() {
+			defer downloaders.Done()
+			for outcome := range resolved {
+				done(downloadURL(ctx, downloader, events, outcome))
+			}
+		}()
+	}
+
+	for _, sourceURL := range urls {
+		if ctx.Err() != nil { // Stop picking up new work once interrupted
+			break
+		}
+		sources <- sourceURL
+	}
+	close(sources)
+	resolvers.Wait() // No more resolved URLs once every resolver is done
+	close(resolved)
+	downloaders.Wait()
+}
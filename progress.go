@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Download outcomes
+)
+
+// Prints one "[done/total]" line per finished URL, serialized so concurrent
+// completions never interleave
+type progressPrinter struct {
+	mu      sync.Mutex // Guards done and writes to writer
+	writer  io.Writer  // Where progress lines go
+	enabled bool       // Whether lines are printed at all
+	total   int        // Number of URLs in the run
+	done    int        // Number of URLs finished so far
+}
+
+// Creates a printer for a run of total URLs; a disabled printer only counts
+func newProgressPrinter(writer io.Writer, total int, enabled bool) *progressPrinter {
+	return &progressPrinter{writer: writer, total: total, enabled: enabled}
+}
+
+// Prints a progress line such as "[42/418] downloaded c10005b.pdf (128.0 KiB)"
+func (progress *progressPrinter) report(outcome, name string, bytes int64) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.done++
+	if !progress.enabled {
+		return
+	}
+	line := fmt.Sprintf("[%d/%d] %s %s", progress.done, progress.total, outcome, name)
+	if bytes > 0 {
+		line += fmt.Sprintf(" (%s)", formatBytes(bytes))
+	}
+	fmt.Fprintln(progress.writer, line)
+}
+
+// Returns the number of URLs finished so far
+func (progress *progressPrinter) finished() int {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	return progress.done
+}
+
+// Prints the progress line for a processed URL
+func (progress *progressPrinter) reportOutcome(outcome urlOutcome) {
+	if outcome.Skip != "" { // Never downloaded, so name it by URL
+		progress.report(outcome.Skip, outcome.Result.URL, 0)
+		return
+	}
+	progress.reportResult(outcome.Result, outcome.Err)
+}
+
+// Prints the progress line for a finished download
+func (progress *progressPrinter) reportResult(result sds.Result, err error) {
+	name := result.URL // Fall back to the URL when no file was chosen
+	if result.Path != "" {
+		name = filepath.Base(result.Path)
+	}
+	var outcome string
+	switch {
+	case result.Status == sds.StatusInvalidContentType:
+		outcome = "rejected (not a PDF)"
+	case err != nil:
+		outcome = "failed"
+	case result.Status == sds.StatusSkipped:
+		outcome = "skipped"
+	case result.Replaced:
+		outcome = "overwrote"
+	default:
+		outcome = "downloaded"
+	}
+	progress.report(outcome, name, result.Bytes)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Failure kinds
+)
+
+// One URL's entry in the JSON report
+type reportEntry struct {
+	SourceURL   string  `json:"source_url"`             // URL from the input list
+	ResolvedURL string  `json:"resolved_url,omitempty"` // URL after following redirects
+	Status      string  `json:"status"`                 // downloaded, skipped, failed or invalid_content_type
+	Path        string  `json:"path,omitempty"`         // File the PDF was saved to
+	Bytes       int64   `json:"bytes"`                  // Number of bytes written
+	SHA256      string  `json:"sha256,omitempty"`       // Hex SHA-256 of the downloaded PDF
+	Reason      string  `json:"reason,omitempty"`       // Why the URL was never downloaded
+	Error       string  `json:"error,omitempty"`        // Why the URL failed
+	ErrorKind   string  `json:"error_kind,omitempty"`   // Category of the failure, e.g. network or blocked
+	Seconds     float64 `json:"duration_seconds"`       // Time spent on the URL
+}
+
+// Run-wide counts at the top of the JSON report
+type reportTotals struct {
+	URLs    int            `json:"urls"`             // Number of URLs processed
+	Status  map[string]int `json:"status"`           // Status → number of URLs
+	Bytes   int64          `json:"bytes"`            // Total size of the PDFs written
+	Seconds float64        `json:"duration_seconds"` // Wall-clock time of the run
+}
+
+// Goroutine-safe collection of per-URL outcomes, written as JSON at the end of a run
+type runReport struct {
+	mu      sync.Mutex    // Guards entries
+	started time.Time     // When the run began
+	entries []reportEntry // One entry per processed URL, in completion order
+}
+
+// Creates a report whose duration starts now
+func newRunReport() *runReport {
+	return &runReport{started: time.Now()}
+}
+
+// Adds the outcome of one URL
+func (report *runReport) add(outcome urlOutcome) {
+	entry := reportEntry{
+		SourceURL:   outcome.Source,
+		ResolvedURL: outcome.Resolved,
+		Status:      outcome.Result.Status.String(),
+		Path:        outcome.Result.Path,
+		Bytes:       outcome.Result.Bytes,
+		SHA256:      outcome.Result.SHA256,
+		Reason:      outcome.Skip,
+		Seconds:     outcome.Duration.Seconds(),
+	}
+	if outcome.Err != nil {
+		entry.Error = outcome.Err.Error()
+		entry.ErrorKind = string(sds.ErrorKindOf(outcome.Err))
+	}
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	report.entries = append(report.entries, entry)
+}
+
+// Writes the totals and every entry to path as indented JSON
+func (report *runReport) write(path string) error {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	totals := reportTotals{
+		URLs:    len(report.entries),
+		Status:  make(map[string]int),
+		Seconds: time.Since(report.started).Seconds(),
+	}
+	for _, entry := range report.entries {
+		totals.Status[entry.Status]++
+		totals.Bytes += entry.Bytes
+	}
+	data, err := json.MarshalIndent(struct {
+		Totals reportTotals  `json:"totals"`
+		URLs   []reportEntry `json:"urls"`
+	}{totals, report.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,70 @@
+package sds
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Archive collects downloaded PDFs as entries of a single zip file.
+// It is safe for concurrent use.
+type Archive struct {
+	mu     sync.Mutex      // Guards writer and names
+	path   string          // Final location of the zip file
+	file   *os.File        // Temporary file the zip is written to until Close
+	writer *zip.Writer     // Writer producing the zip entries
+	names  map[string]bool // Entry names already added
+}
+
+// CreateArchive starts a zip archive at path. The archive is written to a
+// temporary ".part" file and only appears at path once Close succeeds.
+func CreateArchive(path string) (*Archive, error) {
+	file, err := os.Create(path + ".part")
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{
+		path:   path,
+		file:   file,
+		writer: zip.NewWriter(file),
+		names:  make(map[string]bool),
+	}, nil
+}
+
+// Add stores the content under name, reporting false without writing anything
+// when an entry of that name was already added
+func (archive *Archive) Add(name string, content io.Reader) (bool, error) {
+	archive.mu.Lock()
+	defer archive.mu.Unlock()
+	if archive.names[name] {
+		return false, nil
+	}
+	entry, err := archive.writer.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(entry, content); err != nil {
+		return false, err
+	}
+	archive.names[name] = true
+	return true, nil
+}
+
+// Close finishes the zip and moves it into place
+func (archive *Archive) Close() error {
+	archive.mu.Lock()
+	defer archive.mu.Unlock()
+	err := errors.Join(archive.writer.Close(), archive.file.Close())
+	if err != nil {
+		os.Remove(archive.file.Name()) // Don't leave a corrupt archive behind
+		return err
+	}
+	return os.Rename(archive.file.Name(), archive.path)
+}
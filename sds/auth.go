@@ -0,0 +1,284 @@
+package sds
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/fetch" // Request interception to answer auth challenges
+	"github.com/chromedp/chromedp"      // External package to control Chrome/Chromium browser
+)
+
+// Credentials are a username and password for HTTP basic auth
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Netrc holds the credentials of a .netrc file, by host
+type Netrc struct {
+	machines map[string]Credentials // Lowercase host → its "machine" entry
+	fallback *Credentials           // The "default" entry, for any other host (nil if none)
+}
+
+// ReadNetrc parses the .netrc file at path
+func ReadNetrc(path string) (*Netrc, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	netrc, err := ParseNetrc(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return netrc, nil
+}
+
+// ParseNetrc reads credentials in the standard .netrc format: "machine",
+// "login" and "password" tokens separated by whitespace or newlines, plus an
+// optional "default" entry. "account" values and "macdef" macros are skipped,
+// as are lines starting with "#". Quoted tokens are not supported.
+func ParseNetrc(reader io.Reader) (*Netrc, error) {
+	tokens, err := netrcTokens(reader)
+	if err != nil {
+		return nil, err
+	}
+	netrc := &Netrc{machines: make(map[string]Credentials)}
+	var current *Credentials // Entry the login and password tokens belong to
+	var host string          // Host of current ("" for the default entry)
+	finish := func() {
+		switch {
+		case current == nil:
+		case host == "":
+			netrc.fallback = current
+		default:
+			if _, seen := netrc.machines[host]; !seen { // The first entry for a host wins
+				netrc.machines[host] = *current
+			}
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		keyword := tokens[i]
+		switch keyword.text {
+		case "default":
+			finish()
+			current, host = &Credentials{}, ""
+			continue
+		case "machine", "login", "password", "account":
+		default:
+			return nil, fmt.Errorf("line %d: unexpected token %q", keyword.line, keyword.text)
+		}
+		if i+1 == len(tokens) {
+			return nil, fmt.Errorf("line %d: missing value after %q", keyword.line, keyword.text)
+		}
+		i++
+		value := tokens[i].text
+		if keyword.text == "machine" {
+			finish()
+			current, host = &Credentials{}, strings.ToLower(value)
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: %q before any machine", keyword.line, keyword.text)
+		}
+		switch keyword.text {
+		case "login":
+			current.Username = value
+		case "password":
+			current.Password = value
+		}
+	}
+	finish()
+	return netrc, nil
+}
+
+// A token of a .netrc file and the line it is on
+type netrcToken struct {
+	text string
+	line int
+}
+
+// Splits a .netrc file into tokens, leaving out comments and macro definitions
+func netrcTokens(reader io.Reader) ([]netrcToken, error) {
+	var tokens []netrcToken
+	inMacro := false
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if inMacro { // A macro runs up to the next blank line
+			inMacro = text != ""
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		for _, field := range strings.Fields(text) {
+			if field == "macdef" { // The rest of the line is the macro's name
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, netrcToken{text: field, line: line})
+		}
+	}
+	return tokens, scanner.Err()
+}
+
+// Returns the credentials for host: its own entry, or else the default one
+func (netrc *Netrc) lookup(host string) (Credentials, bool) {
+	if netrc == nil {
+		return Credentials{}, false
+	}
+	if credentials, ok := netrc.machines[strings.ToLower(host)]; ok {
+		return credentials, true
+	}
+	if netrc.fallback != nil {
+		return *netrc.fallback, true
+	}
+	return Credentials{}, false
+}
+
+// Credentials taken out of "user:pass@host" URLs, by host, so the URLs can
+// be logged and saved without them
+type credentialStore struct {
+	mu      sync.Mutex             // Guards byHost and byProxy
+	byHost  map[string]Credentials // Lowercase host → credentials from its URLs
+	byProxy map[string]Credentials // Lowercase proxy host:port → credentials from the proxy URL
+}
+
+// Remembers the credentials of a "user:pass@host" proxy URL, if it has any,
+// for Chrome's proxy auth challenges
+func (store *credentialStore) addProxy(proxyURL *url.URL) {
+	if proxyURL == nil || proxyURL.User == nil {
+		return
+	}
+	password, _ := proxyURL.User.Password()
+	store.mu.Lock()
+	store.byProxy[proxyAddress(proxyURL)] = Credentials{Username: proxyURL.User.Username(), Password: password}
+	store.mu.Unlock()
+}
+
+// Returns the credentials of the proxy at origin, as Chrome reports it in a
+// proxy auth challenge (e.g. "http://proxy.internal:3128")
+func (store *credentialStore) proxyCredentials(origin string) (Credentials, bool) {
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return Credentials{}, false
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	credentials, ok := store.byProxy[proxyAddress(parsed)]
+	return credentials, ok
+}
+
+// Returns the lowercase host:port of a proxy URL, with the scheme's default
+// port filled in, so "http://proxy" and "http://proxy:80" match
+func proxyAddress(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		port = map[string]string{"https": "443", "socks5": "1080"}[proxyURL.Scheme]
+	}
+	if port == "" {
+		port = "80"
+	}
+	return net.JoinHostPort(strings.ToLower(proxyURL.Hostname()), port)
+}
+
+// StripCredentials removes the "user:pass@" part of rawURL, remembering it
+// for the URL's host so requests there are authenticated, and returns the URL
+// without it. Resolve and Download do this themselves; call it first to keep
+// the credentials out of anything the caller logs or reports.
+func (downloader *Downloader) StripCredentials(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL
+	}
+	password, _ := parsed.User.Password()
+	store := downloader.auth
+	store.mu.Lock()
+	store.byHost[strings.ToLower(parsed.Hostname())] = Credentials{Username: parsed.User.Username(), Password: password}
+	store.mu.Unlock()
+	parsed.User = nil
+	return parsed.String()
+}
+
+// Returns the credentials for the host of rawURL: those of its URLs first,
+// then Config.Netrc's
+func (downloader *Downloader) credentialsFor(rawURL string) (Credentials, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return Credentials{}, false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	store := downloader.auth
+	store.mu.Lock()
+	credentials, ok := store.byHost[host]
+	store.mu.Unlock()
+	if ok {
+		return credentials, true
+	}
+	return downloader.Netrc.lookup(host)
+}
+
+// Reports whether any host or proxy has credentials, which is when the browser
+// has to answer auth challenges
+func (downloader *Downloader) hasCredentials() bool {
+	store := downloader.auth
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return len(store.byHost) > 0 || len(store.byProxy) > 0 || downloader.Netrc != nil
+}
+
+// Lets the tab of tabCtx answer HTTP auth challenges with the credentials for
+// the challenged host, or for the proxy, until the returned function is called.
+// Every request of the tab is paused on the way and continued unchanged, so
+// this is only done when some host has credentials. Credentials are never logged.
+func (downloader *Downloader) answerAuthChallenges(tabCtx context.Context) (func(), error) {
+	if !downloader.hasCredentials() {
+		return func() {}, nil
+	}
+	listenCtx, stopListening := context.WithCancel(tabCtx) // A pooled tab outlives this URL
+	var mu sync.Mutex
+	answered := make(map[fetch.RequestID]bool) // Requests already given credentials
+	chromedp.ListenTarget(listenCtx, func(event any) {
+		switch event := event.(type) {
+		case *fetch.EventRequestPaused:
+			go chromedp.Run(tabCtx, fetch.ContinueRequest(event.RequestID))
+		case *fetch.EventAuthRequired:
+			response := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseCancelAuth}
+			mu.Lock()
+			retry := answered[event.RequestID] // Asked again, so the credentials were wrong
+			answered[event.RequestID] = true
+			mu.Unlock()
+			credentials, ok := downloader.credentialsFor(event.Request.URL)
+			if event.AuthChallenge.Source == fetch.AuthChallengeSourceProxy {
+				credentials, ok = downloader.auth.proxyCredentials(event.AuthChallenge.Origin)
+			}
+			if ok && !retry {
+				response = &fetch.AuthChallengeResponse{
+					Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+					Username: credentials.Username,
+					Password: credentials.Password,
+				}
+			} else {
+				slog.Debug("Cancelling browser auth challenge", "url", event.Request.URL, "has_credentials", ok, "retry", retry)
+			}
+			go chromedp.Run(tabCtx, fetch.ContinueWithAuth(event.RequestID, response))
+		}
+	})
+	if err := chromedp.Run(tabCtx, fetch.Enable().WithHandleAuthRequests(true)); err != nil {
+		stopListening()
+		return nil, fmt.Errorf("enable auth handling: %w", err)
+	}
+	return func() {
+		chromedp.Run(tabCtx, fetch.Disable()) // Later URLs of a pooled tab aren't paused
+		stopListening()
+	}, nil
+}
@@ -0,0 +1,43 @@
+package sds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/chromedp/chromedp" // External package to control Chrome/Chromium browser
+)
+
+// ErrBlocked is returned when a URL resolves to an access-denied, captcha or
+// login page instead of a document
+var ErrBlocked = errors.New("blocked by access-denied or captcha page")
+
+// DefaultBlockedPattern matches the title or text of pages that stand between the browser and a document
+const DefaultBlockedPattern = `(?i)access denied|captcha|please log ?in|verify you are (a )?human`
+
+// Longest stretch of page text searched for Config.BlockedPattern
+const blockedTextLimit = 20000
+
+// Returns ErrBlocked when the page loaded in ctx matches Config.BlockedPattern.
+// PDFs are never inspected, and failing to read the page is not treated as a block.
+func (downloader *Downloader) checkBlocked(ctx context.Context, pageURL string) error {
+	if downloader.BlockedPattern == nil || looksLikePDF(pageURL) {
+		return nil
+	}
+	var title, text string
+	err := chromedp.Run(ctx,
+		chromedp.Title(&title),
+		chromedp.Evaluate(fmt.Sprintf("document.body ? document.body.innerText.slice(0, %d) : ''", blockedTextLimit), &text),
+	)
+	if err != nil {
+		slog.Debug("Failed to read page text", "url", pageURL, "error", err)
+		return nil
+	}
+	for _, content := range []string{title, text} {
+		if marker := downloader.BlockedPattern.FindString(content); marker != "" {
+			return fmt.Errorf("%w: %s (title %q, matched %q)", ErrBlocked, pageURL, title, marker)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package sds
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/chromedp" // External package to control Chrome/Chromium browser
+)
+
+// A headless Chrome process shared by every Resolve call; each call opens its
+// own tab with its own deadline, so one hanging page can't hold up the others.
+// With several proxies, each has its own browser, because Chrome only takes a
+// proxy when it is launched.
+type sharedBrowser struct {
+	proxyURL    *url.URL           // Proxy the browser is launched with (nil means the proxy environment variables)
+	mu          sync.Mutex         // Guards the fields below
+	ctx         context.Context    // Browser context new tabs are derived from
+	cancel      context.CancelFunc // Closes the browser
+	cancelAlloc context.CancelFunc // Stops the Chrome process
+	idle        []*browserTab      // Open tabs waiting to resolve another URL, for Config.TabPool
+}
+
+// Returns the context of the browser for the next proxy in the rotation,
+// starting Chrome on first use or after it died
+func (downloader *Downloader) browserContext() (context.Context, error) {
+	return downloader.launch(downloader.browsers[downloader.proxies.pick()])
+}
+
+// Returns the context of a browser, starting Chrome on first use or after it died
+func (downloader *Downloader) launch(shared *sharedBrowser) (context.Context, error) {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if shared.ctx != nil && shared.ctx.Err() == nil {
+		return shared.ctx, nil
+	}
+	shared.close() // Clean up after a crashed browser before starting a new one
+
+	// Configure Chrome options
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", !downloader.Headful), // Run headless unless watching it for debugging
+		chromedp.Flag("no-sandbox", true),
+		chromedp.Flag("disable-gpu", true),
+	)
+	// Send browser traffic through the same proxies as downloads
+	opts = append(opts, downloader.proxyOptions(shared.proxyURL)...)
+	if downloader.Insecure { // Same trust as the download client
+		opts = append(opts, chromedp.Flag("ignore-certificate-errors", true))
+	}
+	if downloader.ChromePath != "" { // Use a specific Chrome binary instead of searching for one
+		opts = append(opts, chromedp.ExecPath(downloader.ChromePath))
+	}
+	for _, flag := range downloader.ChromeFlags { // Extra command line switches, e.g. for containers
+		opts = append(opts, chromeFlag(flag))
+	}
+
+	// The browser outlives any single call, so it is not tied to a caller's context
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	ctx, cancel := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(ctx); err != nil { // Launch Chrome now so failures surface here
+		cancel()
+		cancelAlloc()
+		return nil, err
+	}
+	shared.ctx, shared.cancel, shared.cancelAlloc = ctx, cancel, cancelAlloc
+	shared.warmTabs(downloader, ctx)
+	return ctx, nil
+}
+
+// Converts a command line switch such as "--disable-dev-shm-usage" or
+// "--window-size=1280,1024" into an allocator option
+func chromeFlag(flag string) chromedp.ExecAllocatorOption {
+	name, value, hasValue := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+	if !hasValue {
+		return chromedp.Flag(name, true)
+	}
+	return chromedp.Flag(name, value)
+}
+
+// Shuts the browser down; must be called with mu held
+func (shared *sharedBrowser) close() {
+	for _, tab := range shared.idle {
+		tab.cancel()
+	}
+	if shared.cancel != nil {
+		shared.cancel()
+		shared.cancelAlloc()
+	}
+	shared.ctx, shared.cancel, shared.cancelAlloc, shared.idle = nil, nil, nil, nil
+}
+
+// Close shuts down the browsers used by Resolve and saves the download
+// metadata and resolve cache. The Downloader may still be used afterwards;
+// the next Resolve starts a new browser.
+func (downloader *Downloader) Close() error {
+	downloader.metadata.flush()
+	downloader.resolved.flush()
+	for _, shared := range downloader.browsers {
+		shared.mu.Lock()
+		shared.close()
+		shared.mu.Unlock()
+	}
+	return nil
+}
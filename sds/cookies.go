@@ -0,0 +1,62 @@
+package sds
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network" // Browser cookie access
+	"github.com/chromedp/chromedp"        // External package to control Chrome/Chromium browser
+)
+
+// Copies the cookies the browser holds for the given URLs into the download
+// client's jar, so a session Chrome established while resolving (for example on
+// a login redirect) is also used to download the PDF. Passing both the source
+// and the resolved URL covers chains that end on a different host.
+func (downloader *Downloader) shareBrowserCookies(ctx context.Context, urls ...string) {
+	if downloader.HTTPClient.Jar == nil {
+		return
+	}
+	var cookies []*network.Cookie
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		cookies, err = network.GetCookies().WithURLs(urls).Do(ctx)
+		return err
+	}))
+	if err != nil {
+		slog.Debug("Failed to read browser cookies", "url", urls[len(urls)-1], "error", err)
+		return
+	}
+	for _, cookie := range cookies {
+		cookieURL, httpCookie := toHTTPCookie(cookie)
+		downloader.HTTPClient.Jar.SetCookies(cookieURL, []*http.Cookie{httpCookie})
+	}
+}
+
+// Converts a browser cookie into an http.Cookie and the URL the jar should file it under
+func toHTTPCookie(cookie *network.Cookie) (*url.URL, *http.Cookie) {
+	scheme := "http"
+	if cookie.Secure {
+		scheme = "https"
+	}
+	host := strings.TrimPrefix(cookie.Domain, ".")
+	httpCookie := &http.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HTTPOnly,
+	}
+	if strings.HasPrefix(cookie.Domain, ".") { // A leading dot marks a cookie shared with subdomains
+		httpCookie.Domain = host
+	}
+	if !cookie.Session && cookie.Expires > 0 {
+		seconds, fraction := math.Modf(cookie.Expires)
+		httpCookie.Expires = time.Unix(int64(seconds), int64(fraction*1e9))
+	}
+	return &url.URL{Scheme: scheme, Host: host, Path: cookie.Path}, httpCookie
+}
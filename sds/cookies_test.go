@@ -0,0 +1,129 @@
+package sds
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/cdproto/network" // Browser cookies as shareBrowserCookies reads them
+)
+
+func TestDownloadSendsSessionCookie(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("ASP.NET_SessionId"); err != nil || cookie.Value != "s3ss10n" {
+			http.Error(w, "session required", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(testPDF))
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name  string
+		setup func(downloader *Downloader)
+		ok    bool
+	}{
+		{"no cookie", func(*Downloader) {}, false},
+		{"configured cookie", func(downloader *Downloader) {
+			downloader.Cookies = []*http.Cookie{{Name: "ASP.NET_SessionId", Value: "s3ss10n"}}
+		}, true},
+		{"browser cookie", func(downloader *Downloader) { // As shareBrowserCookies files it after resolving
+			cookieURL, cookie := toHTTPCookie(&network.Cookie{
+				Name: "ASP.NET_SessionId", Value: "s3ss10n", Domain: serverURL.Hostname(), Path: "/", Session: true,
+			})
+			downloader.HTTPClient.Jar.SetCookies(cookieURL, []*http.Cookie{cookie})
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			downloader := newTestDownloader(t, nil, Config{}) // The configured client, with its cookie jar
+			test.setup(downloader)
+
+			result, err := downloader.Download(context.Background(), server.URL+"/msds_pi/C10005B.pdf")
+			if test.ok {
+				if err != nil || result.Status != StatusDownloaded {
+					t.Errorf("status = %v, error = %v; want downloaded", result.Status, err)
+				}
+				return
+			}
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+				t.Errorf("error = %v, want 403 without the session cookie", err)
+			}
+		})
+	}
+}
+
+func TestToHTTPCookieDomain(t *testing.T) {
+	downloader := newTestDownloader(t, nil, Config{})
+	for _, cookie := range []*network.Cookie{
+		{Name: "shared", Value: "1", Domain: ".citgo.example", Path: "/"},        // Set for every subdomain
+		{Name: "hostonly", Value: "2", Domain: "login.citgo.example", Path: "/"}, // Only for the login host
+	} {
+		cookieURL, httpCookie := toHTTPCookie(cookie)
+		downloader.HTTPClient.Jar.SetCookies(cookieURL, []*http.Cookie{httpCookie})
+	}
+	tests := []struct {
+		url  string
+		want string // Cookies the jar sends there
+	}{
+		{"http://docs.citgo.example/msds_pi/C10005B.pdf", "shared=1"},
+		{"http://login.citgo.example/", "hostonly=2 shared=1"},
+		{"http://other.example/", ""},
+	}
+	for _, test := range tests {
+		target, _ := url.Parse(test.url)
+		var names []string
+		for _, cookie := range downloader.HTTPClient.Jar.Cookies(target) {
+			names = append(names, cookie.Name+"="+cookie.Value)
+		}
+		slices.Sort(names)
+		if got := strings.Join(names, " "); got != test.want {
+			t.Errorf("cookies for %s = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestResolveSharesCookiesAcrossHosts(t *testing.T) {
+	// The session is set by a login host other than the one the source URL is on
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "ASP.NET_SessionId", Value: "s3ss10n", Path: "/"})
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>Signed in</body></html>"))
+		case "/msds/C10005B.pdf":
+			if cookie, err := r.Cookie("ASP.NET_SessionId"); err != nil || cookie.Value != "s3ss10n" {
+				http.Error(w, "session required", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte(testPDF))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer login.Close()
+	loginURL := strings.Replace(login.URL, "127.0.0.1", "localhost", 1) // Another host name for the same server
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, loginURL+"/login", http.StatusFound)
+	}))
+	defer source.Close()
+	downloader := newBrowserDownloader(t, Config{})
+
+	resolvedURL, err := downloader.Resolve(context.Background(), source.URL+"/LoginFetch.aspx?searchvalue=C10005B")
+	if err != nil || resolvedURL != loginURL+"/login" {
+		t.Fatalf("Resolve = %q, %v; want the login page", resolvedURL, err)
+	}
+	result, err := downloader.Download(context.Background(), loginURL+"/msds/C10005B.pdf")
+	if err != nil || result.Status != StatusDownloaded {
+		t.Errorf("download from the login host: status = %v, error = %v; want the browser's session cookie sent", result.Status, err)
+	}
+}
@@ -0,0 +1,136 @@
+package sds
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DedupeAction is what DedupeByContent does with a file whose content matches
+// another saved file
+type DedupeAction string
+
+const (
+	DedupeReport  DedupeAction = "report"  // Leave the duplicate in place; only report it
+	DedupeSymlink DedupeAction = "symlink" // Replace the duplicate with a relative symlink to the kept file
+	DedupeDelete  DedupeAction = "delete"  // Delete the duplicate and forget its metadata
+)
+
+// ParseDedupeAction checks a dedupe action given on the command line
+func ParseDedupeAction(name string) (DedupeAction, error) {
+	switch action := DedupeAction(name); action {
+	case DedupeReport, DedupeSymlink, DedupeDelete:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown dedupe action %q (want %q, %q or %q)", name, DedupeReport, DedupeSymlink, DedupeDelete)
+}
+
+// Duplicate is a saved file byte-identical to another one, which is kept
+type Duplicate struct {
+	Path   string // Duplicate file, relative to OutputDir with forward slashes
+	KeptAs string // File with the same content that stays, relative to OutputDir
+	SHA256 string // Hex SHA-256 both files share
+	Size   int64  // Number of bytes in each
+}
+
+// DedupeByContent groups the files saved in OutputDir, this run or earlier, by
+// the SHA-256 recorded for them and applies action to all but the first path
+// of each group. Every candidate is hashed again first, so a file changed
+// since it was recorded is never mistaken for a copy. Files already replaced
+// by a symlink are left alone. It returns the duplicates found and the number
+// of distinct documents.
+func (downloader *Downloader) DedupeByContent(action DedupeAction) ([]Duplicate, int, error) {
+	store := downloader.metadata
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+
+	dir := filepath.Dir(store.path)
+	names := make([]string, 0, len(store.entries))
+	for name := range store.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names) // The first path of a group is the one kept
+
+	groups := make(map[string][]string) // SHA-256 → names of regular files with that content
+	var digests []string                // Keys of groups in order of first appearance
+	for _, name := range names {
+		info, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || !info.Mode().IsRegular() { // Gone, or already a symlink
+			continue
+		}
+		digest := store.entries[name].SHA256
+		if digest == "" { // Files saved before checksums were recorded have none
+			digest = "unrecorded:" + name
+		}
+		if _, seen := groups[digest]; !seen {
+			digests = append(digests, digest)
+		}
+		groups[digest] = append(groups[digest], name)
+	}
+
+	var duplicates []Duplicate
+	distinct := 0
+	for _, digest := range digests {
+		group := groups[digest]
+		distinct++
+		if len(group) < 2 {
+			continue
+		}
+		kept := group[0]
+		keptSHA256, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(kept)))
+		if err != nil {
+			return duplicates, distinct, err
+		}
+		for _, name := range group[1:] {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			sha256, err := fileSHA256(path)
+			if err != nil {
+				return duplicates, distinct, err
+			}
+			if sha256 != keptSHA256 { // Changed on disk since it was recorded
+				slog.Warn("Not deduplicating file that no longer matches its recorded checksum", "path", path)
+				distinct++
+				continue
+			}
+			if err := applyDedupeAction(action, path, filepath.Join(dir, filepath.FromSlash(kept))); err != nil {
+				return duplicates, distinct, err
+			}
+			if action == DedupeDelete {
+				delete(store.entries, name)
+			}
+			duplicates = append(duplicates, Duplicate{Path: name, KeptAs: kept, SHA256: sha256, Size: store.entries[kept].Size})
+		}
+	}
+	if action == DedupeDelete && len(duplicates) > 0 {
+		if err := writeJSONFile(store.path, store.entries); err != nil {
+			slog.Warn("Failed to save metadata file", "path", store.path, "error", err)
+		}
+	}
+	return duplicates, distinct, nil
+}
+
+// Deletes the duplicate at path or replaces it with a symlink to keptPath
+func applyDedupeAction(action DedupeAction, path, keptPath string) error {
+	switch action {
+	case DedupeDelete:
+		return os.Remove(path)
+	case DedupeSymlink:
+		target, err := filepath.Rel(filepath.Dir(path), keptPath) // Relative, so the mirror can move
+		if err != nil {
+			return err
+		}
+		link := path + ".link" // Made beside the file, then renamed over it in one step
+		os.Remove(link)
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+		if err := os.Rename(link, path); err != nil {
+			os.Remove(link)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package sds
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	cdplog "github.com/chromedp/cdproto/log" // Browser log entries
+	"github.com/chromedp/cdproto/network"    // Failed request events
+	"github.com/chromedp/cdproto/runtime"    // Console and exception events
+	"github.com/chromedp/chromedp"           // External package to control Chrome/Chromium browser
+)
+
+// Most problems kept per tab; later ones are only counted
+const maxPageProblems = 10
+
+// Console errors, uncaught exceptions and failed requests seen in a tab, which
+// often explain why a page never redirected to its PDF
+type pageProblems struct {
+	mu       sync.Mutex                   // Guards the fields below
+	requests map[network.RequestID]string // Request ID → URL, to name failed requests
+	problems []string                     // Short descriptions, oldest first
+	dropped  int                          // Problems beyond maxPageProblems
+}
+
+// Starts collecting problems in the tab of tabCtx when debug logging is on;
+// returns nil otherwise, which every method accepts
+func watchPageProblems(ctx, tabCtx context.Context) *pageProblems {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+	watched := &pageProblems{requests: make(map[network.RequestID]string)}
+	chromedp.ListenTarget(tabCtx, func(event any) {
+		switch event := event.(type) {
+		case *runtime.EventConsoleAPICalled:
+			if event.Type == runtime.APITypeError {
+				watched.add("console error: " + consoleText(event.Args))
+			}
+		case *runtime.EventExceptionThrown:
+			details := event.ExceptionDetails
+			text := details.Text
+			if details.Exception != nil && details.Exception.Description != "" {
+				text = details.Exception.Description
+			}
+			watched.add("uncaught exception: " + firstLine(text))
+		case *cdplog.EventEntryAdded:
+			if event.Entry.Level == cdplog.LevelError {
+				watched.add(fmt.Sprintf("browser error: %s (%s)", firstLine(event.Entry.Text), event.Entry.URL))
+			}
+		case *network.EventRequestWillBeSent:
+			watched.mu.Lock()
+			watched.requests[event.RequestID] = event.Request.URL
+			watched.mu.Unlock()
+		case *network.EventLoadingFailed:
+			if !event.Canceled { // Navigating away cancels requests; that is no failure
+				watched.mu.Lock()
+				requestURL := watched.requests[event.RequestID]
+				watched.mu.Unlock()
+				watched.add(fmt.Sprintf("request failed: %s (%s)", requestURL, event.ErrorText))
+			}
+		}
+	})
+	return watched
+}
+
+// Records one problem
+func (watched *pageProblems) add(problem string) {
+	watched.mu.Lock()
+	defer watched.mu.Unlock()
+	if len(watched.problems) >= maxPageProblems {
+		watched.dropped++
+		return
+	}
+	watched.problems = append(watched.problems, problem)
+}
+
+// Logs the collected problems at debug level after resolving sourceURL failed
+func (watched *pageProblems) logFailure(sourceURL string, err error) {
+	if watched == nil {
+		return
+	}
+	watched.mu.Lock()
+	defer watched.mu.Unlock()
+	if len(watched.problems) == 0 {
+		return
+	}
+	summary := strings.Join(watched.problems, "; ")
+	if watched.dropped > 0 {
+		summary += fmt.Sprintf("; and %d more", watched.dropped)
+	}
+	slog.Debug("Page problems while resolving", "url", sourceURL, "error", err, "problems", summary)
+}
+
+// Joins the arguments of a console call into one line
+func consoleText(args []*runtime.RemoteObject) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch {
+		case arg.Description != "":
+			parts = append(parts, firstLine(arg.Description))
+		case len(arg.Value) > 0:
+			parts = append(parts, strings.Trim(string(arg.Value), `"`))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Returns the first line of text, such as the message of a stack trace
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return strings.TrimSpace(line)
+}
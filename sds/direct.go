@@ -0,0 +1,105 @@
+package sds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// DirectFields are the values available to a -direct-url template, taken from
+// a spheracloud LoginFetch.aspx URL such as
+// "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001_US_EN"
+type DirectFields struct {
+	SearchValue string // The searchvalue as given (e.g. "622613001_US_EN")
+	Code        string // Product code (e.g. "622613001")
+	Region      string // Region (e.g. "US"), or "" if the searchvalue has none
+	Lang        string // Language (e.g. "EN"), or "" if the searchvalue has none
+	Host        string // Host of the LoginFetch URL (e.g. "apps.spheracloud.net")
+}
+
+// Returns the template fields of a LoginFetch or ViewFetch URL, or false for any other URL
+func directFieldsFor(rawURL string) (DirectFields, bool) {
+	searchValue := sdsSearchValue(rawURL)
+	if searchValue == "" {
+		return DirectFields{}, false
+	}
+	fields := DirectFields{SearchValue: searchValue}
+	if parsedURL, err := url.Parse(rawURL); err == nil {
+		fields.Host = parsedURL.Hostname()
+	}
+	parts := strings.Split(searchValue, "_")
+	fields.Code = parts[0]
+	if len(parts) >= 3 {
+		fields.Region, fields.Lang = parts[len(parts)-2], parts[len(parts)-1]
+	} else if len(parts) == 2 {
+		fields.Lang = parts[1]
+	}
+	return fields, true
+}
+
+// ParseDirectTemplate parses a text/template building the direct document URL
+// of a LoginFetch URL, such as "https://{{.Host}}/sds/{{.SearchValue}}.pdf", and
+// checks it renders a valid URL for a sample so mistakes are reported up front
+func ParseDirectTemplate(text string) (*template.Template, error) {
+	directTemplate, err := template.New("direct").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid direct URL template: %w", err)
+	}
+	sample := "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001_US_EN"
+	fields, _ := directFieldsFor(sample)
+	if _, err := renderDirectURL(directTemplate, fields); err != nil {
+		return nil, fmt.Errorf("invalid direct URL template: %w", err)
+	}
+	return directTemplate, nil
+}
+
+// Renders the direct URL from its fields and checks it is an http(s) URL
+func renderDirectURL(directTemplate *template.Template, fields DirectFields) (string, error) {
+	var buf bytes.Buffer
+	if err := directTemplate.Execute(&buf, fields); err != nil {
+		return "", err
+	}
+	directURL := strings.TrimSpace(buf.String())
+	parsedURL, err := url.ParseRequestURI(directURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return "", fmt.Errorf("rendered %q, which is not an http(s) URL", directURL)
+	}
+	return directURL, nil
+}
+
+// Tries the direct URL Config.DirectURL builds for a LoginFetch URL with a
+// quick HeadCheck, returning it when the server answers with an accepted
+// status and a document. Anything else returns false, so the caller falls back
+// to the browser.
+func (downloader *Downloader) resolveDirect(ctx context.Context, inputURL string) (string, bool) {
+	if downloader.DirectURL == nil {
+		return "", false
+	}
+	fields, ok := directFieldsFor(inputURL)
+	if !ok {
+		return "", false
+	}
+	directURL, err := renderDirectURL(downloader.DirectURL, fields)
+	if err != nil {
+		slog.Debug("Failed to build direct URL", "url", inputURL, "error", err)
+		return "", false
+	}
+	head, err := downloader.HeadCheck(ctx, directURL)
+	switch {
+	case err != nil:
+		slog.Debug("Direct URL failed; resolving in the browser", "url", inputURL, "direct", directURL, "error", err)
+		return "", false
+	case !downloader.acceptsStatus(head.StatusCode):
+		slog.Debug("Direct URL failed; resolving in the browser", "url", inputURL, "direct", directURL, "status", head.Status)
+		return "", false
+	case !downloader.acceptsContentType(head.ContentType) && !looksLikePDF(head.FinalURL):
+		slog.Debug("Direct URL is not a document; resolving in the browser", "url", inputURL, "direct", directURL, "content_type", head.ContentType)
+		return "", false
+	}
+	slog.Debug("Resolved without the browser", "url", inputURL, "direct", directURL)
+	return directURL, true
+}
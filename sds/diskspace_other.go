@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package sds
+
+import "errors"
+
+// FreeSpace is not implemented on this platform, so free space checks are skipped
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
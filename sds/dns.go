@@ -0,0 +1,141 @@
+package sds
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Longest wait for an answer from a DNS-over-HTTPS server when the lookup itself has no deadline
+const dohTimeout = 10 * time.Second
+
+// NewResolver returns a resolver that sends every lookup of the download client
+// to the given server instead of the system's: a DNS server address such as
+// "1.1.1.1", "9.9.9.9:53" or "[2606:4700:4700::1111]:53", or a DNS-over-HTTPS
+// URL such as "https://1.1.1.1/dns-query". An empty address returns nil, which
+// means the system resolver.
+func NewResolver(address string) (*net.Resolver, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(address, "https://") {
+		endpoint, err := url.Parse(address)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid DNS-over-HTTPS URL %q", address)
+		}
+		// The endpoint's own host is looked up by the system resolver, so
+		// an IP address avoids depending on it entirely
+		client := &http.Client{Timeout: dohTimeout}
+		return &net.Resolver{
+			PreferGo: true, // Only the pure Go resolver honors Dial
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return &dohConn{ctx: ctx, client: client, endpoint: endpoint.String()}, nil
+			},
+		}, nil
+	}
+
+	server := address
+	if _, _, err := net.SplitHostPort(address); err != nil { // No port given, so use the standard one
+		server = net.JoinHostPort(strings.Trim(address, "[]"), "53")
+	}
+	host, _, _ := net.SplitHostPort(server)
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("invalid DNS server %q: want an IP address, optionally with a port, or an https:// URL", address)
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &net.Resolver{
+		PreferGo: true, // Only the pure Go resolver honors Dial
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server) // Same protocol, fixed server
+		},
+	}, nil
+}
+
+// A net.Conn carrying the Go resolver's DNS queries to a DNS-over-HTTPS server
+// (RFC 8484). It is not a net.PacketConn, so the resolver frames messages as
+// over TCP, each with a two-byte length prefix.
+type dohConn struct {
+	ctx      context.Context // Context of the lookup the connection was dialed for
+	client   *http.Client    // Client posting the queries
+	endpoint string          // DNS-over-HTTPS URL
+	deadline time.Time       // Latest time an exchange may end (zero means none)
+	query    bytes.Buffer    // Length-prefixed query bytes written so far
+	answer   bytes.Reader    // Length-prefixed answer not yet read
+}
+
+// Collects query bytes; the exchange happens on the next Read
+func (conn *dohConn) Write(data []byte) (int, error) {
+	return conn.query.Write(data)
+}
+
+// Returns answer bytes, posting the pending query first if there is one
+func (conn *dohConn) Read(data []byte) (int, error) {
+	if conn.answer.Len() == 0 && conn.query.Len() > 0 {
+		if err := conn.exchange(); err != nil {
+			return 0, err
+		}
+	}
+	return conn.answer.Read(data)
+}
+
+// Posts the pending query and stores the server's answer
+func (conn *dohConn) exchange() error {
+	framed := conn.query.Bytes()
+	if len(framed) < 2 || int(binary.BigEndian.Uint16(framed)) != len(framed)-2 {
+		return errors.New("dns-over-https: incomplete query")
+	}
+	ctx, cancel := context.WithTimeout(conn.ctx, dohTimeout)
+	defer cancel()
+	if !conn.deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, conn.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", conn.endpoint, bytes.NewReader(framed[2:]))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	conn.query.Reset()
+
+	resp, err := conn.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("dns-over-https: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dns-over-https: unexpected HTTP status %s", resp.Status)
+	}
+	message, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16-1)) // The length prefix caps DNS messages at 64 KiB
+	if err != nil {
+		return fmt.Errorf("dns-over-https: %w", err)
+	}
+	conn.answer.Reset(append(binary.BigEndian.AppendUint16(nil, uint16(len(message))), message...))
+	return nil
+}
+
+// The remaining net.Conn methods; deadlines bound the next exchange
+func (conn *dohConn) Close() error                     { return nil }
+func (conn *dohConn) LocalAddr() net.Addr              { return dohAddr{} }
+func (conn *dohConn) RemoteAddr() net.Addr             { return dohAddr{} }
+func (conn *dohConn) SetReadDeadline(time.Time) error  { return nil }
+func (conn *dohConn) SetWriteDeadline(time.Time) error { return nil }
+func (conn *dohConn) SetDeadline(deadline time.Time) error {
+	conn.deadline = deadline
+	return nil
+}
+
+// Placeholder address of a DNS-over-HTTPS connection
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "https" }
+func (dohAddr) String() string  { return "dns-over-https" }
@@ -0,0 +1,925 @@
+// Package sds resolves Safety Data Sheet links (following HTTP, meta refresh and
+// JavaScript redirects in headless Chrome) and downloads the PDFs they point to.
+package sds
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/publicsuffix" // Public suffix list for the cookie jar
+	"golang.org/x/time/rate"        // Bandwidth limit shared by all downloads
+)
+
+// ErrTooSmall is returned when a response body is smaller than Config.MinSize,
+// which usually means the server sent a truncated document
+var ErrTooSmall = errors.New("download suspiciously small")
+
+// ErrTooLarge is returned when a document is bigger than Config.MaxSize
+var ErrTooLarge = errors.New("download too large")
+
+// ErrInvalidContentType is returned when the server answers with something other than a PDF
+var ErrInvalidContentType = errors.New("invalid content type (expected PDF)")
+
+// ErrNotPDF is returned when a body that passed the Content-Type check is not
+// a PDF after all: one served with a generic type such as binary/octet-stream
+// that lacks the PDF signature, or an HTML page served as a PDF, as login and
+// error pages are
+var ErrNotPDF = errors.New("response is not a PDF")
+
+// DefaultContentTypes are the Content-Types accepted when Config.ContentTypes is empty
+var DefaultContentTypes = []string{"binary/octet-stream", "application/pdf"}
+
+// DefaultAcceptStatus are the HTTP statuses a download accepts when Config.AcceptStatus is empty
+var DefaultAcceptStatus = []int{http.StatusOK}
+
+// Config holds the settings for resolving and downloading documents
+type Config struct {
+	OutputDir           string             // Directory the PDFs are saved in
+	Layout              Layout             // How files are arranged under OutputDir (LayoutFlat if empty)
+	Refresh             bool               // Re-download existing files whose remote copy changed
+	MinSize             int64              // Smallest body accepted as a PDF; smaller ones are retried once
+	MaxSize             int64              // Largest body accepted; bigger ones fail without being saved (0 means no limit)
+	ValidatePDF         bool               // Parse each PDF and quarantine unreadable ones in OutputDir/invalid
+	Since               time.Time          // Skip documents last modified before this time (zero means no limit)
+	Overwrite           bool               // Re-download and replace existing files unconditionally
+	Verify              bool               // Re-download existing files whose SHA-256 no longer matches the recorded one
+	IgnoreRobots        bool               // Fetch URLs even when robots.txt disallows them
+	NoCache             bool               // Resolve every URL in Chrome, ignoring cached results
+	CacheTTL            time.Duration      // How long a cached resolution stays valid
+	ContentTypes        []string           // Accepted Content-Types (DefaultContentTypes if empty)
+	DistrustMagic       bool               // Reject %PDF- bodies served as a type that isn't accepted, unless the Content-Type is missing
+	AcceptStatus        []int              // HTTP statuses whose body is the document (DefaultAcceptStatus if empty)
+	UserAgents          []string           // User-Agent strings rotated per URL (DefaultUserAgent if empty)
+	Headers             http.Header        // Extra headers sent with every download request
+	Cookies             []*http.Cookie     // Extra cookies sent with every download request
+	Netrc               *Netrc             // Basic auth credentials by host for downloads and Chrome (nil for none)
+	ProxyURL            *url.URL           // Proxy for downloads and Chrome (nil means the proxy environment variables)
+	Proxies             []*url.URL         // Proxies rotated across download requests and browser launches (ProxyURL if empty)
+	ProxyRotation       ProxyRotation      // Order in which Proxies are used (round-robin if empty)
+	MirrorHosts         map[string]string  // Host → mirror host whose copy of the same path is tried once when a download fails
+	Insecure            bool               // Skip TLS certificate verification in downloads and Chrome
+	Resolver            *net.Resolver      // DNS resolver for download connections (system resolver if nil)
+	DownloadTimeout     time.Duration      // Timeout for a single PDF download
+	DownloadRetries     int                // Extra attempts after a transient download failure
+	DownloadBackoff     time.Duration      // Wait before the first download retry; doubled for each one after
+	MaxRate             int64              // Combined download rate in bytes per second (0 means unlimited)
+	ChromePath          string             // Chrome executable (found automatically if empty)
+	Headful             bool               // Show the browser window instead of running headless
+	ChromeFlags         []string           // Extra Chrome command line switches, e.g. "--disable-dev-shm-usage"
+	NavigateTimeout     time.Duration      // Timeout for the Chrome tab resolving a URL
+	TabPool             int                // Open tabs kept per browser and reused across URLs (0 opens a new tab for each URL)
+	TabReset            bool               // Clear a pooled tab's cookies and cache before its next URL
+	NavigateRetries     int                // Extra attempts after a failed navigation
+	NavigateBackoff     time.Duration      // Wait before the first retry; doubled for each one after
+	RedirectSettleDelay time.Duration      // With FixedSettle, time to let JS/meta redirects fire after the page loads
+	FixedSettle         bool               // Always wait RedirectSettleDelay instead of until the URL stops changing
+	SettleStable        time.Duration      // How long the URL must stay unchanged to count as settled
+	SettleMax           time.Duration      // Longest wait for the URL to settle
+	HostSettle          HostDurations      // Longest settle wait per host, replacing SettleMax or RedirectSettleDelay there
+	RedirectLoopTimeout time.Duration      // Cutoff for following a chain of redirects
+	ExtractPDFLink      bool               // Look in the resolved page for an embedded or linked PDF
+	DirectURL           *template.Template // Builds the direct document URL of a LoginFetch URL from DirectFields, tried before the browser (nil disables it)
+	SaveHTMLDir         string             // Directory to save the HTML of resolved pages that aren't PDFs ("" disables it)
+	BlockedPattern      *regexp.Regexp     // Title or text of a resolved page that means access was refused (nil disables the check)
+	BlockedRetryDelay   time.Duration      // Wait before resolving a blocked URL once more (0 disables the retry)
+	MinFreeSpace        uint64             // Bytes that must stay free on the output filesystem (0 disables the check)
+	MaxRedirects        int                // Most navigations per URL while resolving (0 means no limit)
+	MaxPerHost          int                // Most simultaneous requests to one host (0 means unlimited)
+	GlobalInterval      time.Duration      // Least time between the starts of any two navigations or downloads (0 means none)
+	IdleConnsPerHost    int                // Keep-alive connections kept open per host for reuse (http.DefaultMaxIdleConnsPerHost if 0)
+	NameTemplate        *template.Template // Names output files from NameFields (URLToFilename if nil)
+	NameSources         []NameSource       // Where filenames come from, first match wins (DefaultNameSources if empty)
+	TagLanguages        bool               // Tag names taken from a URL path with their language by the "-s" convention (e.g. "631310001_es.pdf")
+	FilenameCase        FilenameCase       // Letter case of output filenames (CaseLower if empty)
+}
+
+// HostDurations maps hosts to durations. An entry matches its own host and every
+// subdomain, so "citgo.com" also covers "www.docs.citgo.com"; the longest
+// matching entry wins.
+type HostDurations map[string]time.Duration
+
+// Returns the duration for the host of rawURL, and whether an entry matched
+func (durations HostDurations) forURL(rawURL string) (time.Duration, bool) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || len(durations) == 0 {
+		return 0, false
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	var duration time.Duration
+	best := -1 // Length of the most specific matching entry so far
+	for entry, value := range durations {
+		entry = strings.ToLower(strings.TrimPrefix(entry, "."))
+		if (host == entry || strings.HasSuffix(host, "."+entry)) && len(entry) > best {
+			duration, best = value, len(entry)
+		}
+	}
+	return duration, best >= 0
+}
+
+// Layout selects how downloaded files are arranged in the output directory
+type Layout string
+
+const (
+	LayoutFlat   Layout = "flat"    // Every file directly in OutputDir; colliding names get a URL hash suffix
+	LayoutByHost Layout = "by-host" // Files under OutputDir/host/path, mirroring the URL
+)
+
+// ParseLayout checks a layout name given on the command line
+func ParseLayout(name string) (Layout, error) {
+	switch layout := Layout(name); layout {
+	case LayoutFlat, LayoutByHost:
+		return layout, nil
+	}
+	return "", fmt.Errorf("unknown output layout %q (want %q or %q)", name, LayoutFlat, LayoutByHost)
+}
+
+// Status describes the outcome of a download
+type Status int
+
+const (
+	StatusDownloaded         Status = iota // PDF saved to disk
+	StatusSkipped                          // File already present on disk
+	StatusFailed                           // Network, HTTP or write error
+	StatusInvalidContentType               // Server answered with something other than a PDF
+)
+
+// String returns the lowercase name of the status, as used in reports
+func (status Status) String() string {
+	switch status {
+	case StatusDownloaded:
+		return "downloaded"
+	case StatusSkipped:
+		return "skipped"
+	case StatusFailed:
+		return "failed"
+	case StatusInvalidContentType:
+		return "invalid_content_type"
+	}
+	return fmt.Sprintf("Status(%d)", int(status))
+}
+
+// Result reports what happened to a single URL passed to Download
+type Result struct {
+	URL      string // URL that was downloaded
+	Path     string // File the PDF was (or already had been) saved to; the entry name in archive mode
+	Status   Status // Outcome of the download
+	Bytes    int64  // Number of bytes written
+	Replaced bool   // Whether an existing file was overwritten
+	SHA256   string // Hex SHA-256 of the downloaded PDF
+}
+
+// Downloader resolves and downloads SDS PDFs into Config.OutputDir.
+// It is safe for concurrent use.
+type Downloader struct {
+	Config                  // Settings for resolving and downloading
+	HTTPClient *http.Client // Client reused by every request; built by New, replaceable before first use
+	Stats      *Stats       // Outcome counters updated by Download
+	Archive    *Archive     // When set, PDFs are added to this zip instead of OutputDir
+	Sink       Sink         // When set, PDFs are streamed here instead of to OutputDir
+
+	writeMu  sync.Mutex       // Serializes picking an output path and writing the file
+	claims   *outputRegistry  // Output paths claimed during this Downloader's lifetime
+	metadata *metadataStore   // Validators of saved files, used by Refresh
+	agents   *userAgentPool   // User-Agent rotation shared by Resolve and Download
+	sources  *sourceInfoStore // Metadata given to Describe, by source and resolved URL
+	auth     *credentialStore // Basic auth credentials taken out of "user:pass@" URLs
+	robots   *robotsCache     // Parsed robots.txt per site, used by Allowed
+	resolved *resolveCache    // Source URL → resolved URL from earlier runs, used by Resolve
+	browsers []*sharedBrowser // Chrome instances whose tabs Resolve navigates, one per proxy
+	proxies  *proxyPool       // Proxy rotation shared by downloads and browsers
+	hosts    *hostLimiter     // Per-host cap on simultaneous navigations and downloads
+	limiter  *rate.Limiter    // Shared bandwidth budget for Config.MaxRate (nil means unlimited)
+	pacer    *rate.Limiter    // Spacing of request starts for Config.GlobalInterval (nil means none)
+}
+
+// New creates a Downloader whose HTTP client honors the configured timeout and proxy.
+// Call Close when done to shut down the browser started by Resolve.
+func New(config Config) *Downloader {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List}) // Never fails
+	proxies := newProxyPool(config)
+	browsers := make([]*sharedBrowser, len(proxies.proxies)) // Chrome takes its proxy at launch
+	auth := &credentialStore{byHost: make(map[string]Credentials), byProxy: make(map[string]Credentials)}
+	for index, proxyURL := range proxies.proxies {
+		browsers[index] = &sharedBrowser{proxyURL: proxyURL}
+		auth.addProxy(proxyURL) // Chrome ignores credentials in --proxy-server, so they are answered when challenged
+	}
+	// One transport for every request, so downloads from the same host reuse
+	// warm connections instead of repeating the TCP and TLS handshakes
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = max(config.IdleConnsPerHost, http.DefaultMaxIdleConnsPerHost)
+	if config.Resolver != nil { // Look hosts up through the configured DNS server
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Resolver: config.Resolver}
+		transport.DialContext = dialer.DialContext
+	}
+	if proxies.enabled() { // Route each download through the next proxy
+		transport.Proxy = proxies.forRequest
+	}
+	if config.Insecure { // Accept self-signed certificates of internal mirrors
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	// Create HTTP client with timeout; the jar keeps session cookies set by the servers
+	client := &http.Client{Timeout: config.DownloadTimeout, Jar: jar, Transport: transport}
+	return &Downloader{
+		Config:     config,
+		HTTPClient: client,
+		Stats:      &Stats{},
+		claims:     &outputRegistry{owners: make(map[string]string)},
+		metadata:   newMetadataStore(config.OutputDir),
+		agents:     newUserAgentPool(config.UserAgents),
+		sources:    &sourceInfoStore{byURL: make(map[string]SourceInfo)},
+		auth:       auth,
+		robots:     newRobotsCache(),
+		resolved:   newResolveCache(config.OutputDir),
+		browsers:   browsers,
+		proxies:    proxies,
+		hosts:      newHostLimiter(config.MaxPerHost),
+		limiter:    newRateLimiter(config.MaxRate),
+		pacer:      newRequestPacer(config.GlobalInterval),
+	}
+}
+
+// Tracks which source URL produced each output path
+type outputRegistry struct {
+	mu     sync.Mutex        // Guards owners
+	owners map[string]string // Output path → source URL that claimed it
+}
+
+// Returns the source URL that claimed the path, if any. Paths differing only
+// in case are the same, as they are on case-insensitive filesystems.
+func (registry *outputRegistry) ownerOf(path string) (string, bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	owner, ok := registry.owners[strings.ToLower(path)]
+	return owner, ok
+}
+
+// Records that the path now belongs to the given source URL
+func (registry *outputRegistry) claim(path, sourceURL string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.owners[strings.ToLower(path)] = sourceURL
+}
+
+// Forgets the claim of sourceURL on the path, leaving other URLs' claims alone
+func (registry *outputRegistry) release(path, sourceURL string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.owners[strings.ToLower(path)] == sourceURL {
+		delete(registry.owners, strings.ToLower(path))
+	}
+}
+
+// OutputPath returns the path a resolved URL would be saved to inside the output directory
+func (downloader *Downloader) OutputPath(finalURL string) string {
+	return downloader.resolveOutputPath(finalURL)
+}
+
+// ExistingOutput returns the saved file a source URL produces when that can be
+// told without resolving it, or "" otherwise. That holds for a URL the metadata
+// lists as the source of an existing file, and for a direct link to a PDF (a
+// path ending in ".pdf", without a query), which is named after its own path.
+// Other URLs, such as spheracloud LoginFetch links, are named after where they
+// redirect and need resolving.
+func (downloader *Downloader) ExistingOutput(sourceURL string) string {
+	if !downloader.savesLocally() { // Nothing is saved in OutputDir
+		return ""
+	}
+	if filePath := downloader.metadata.pathFor(sourceURL); filePath != "" && FileExists(filePath) {
+		return filePath
+	}
+	parsedURL, err := url.Parse(sourceURL)
+	if err != nil || parsedURL.RawQuery != "" || strings.ToLower(getFileExtension(parsedURL.Path)) != ".pdf" {
+		return ""
+	}
+	if filePath := downloader.resolveOutputPath(sourceURL); FileExists(filePath) {
+		downloader.metadata.adopt(filePath, sourceURL) // So manifests list it, like any skipped file
+		return filePath
+	}
+	return ""
+}
+
+// Returns the output path for a resolved URL before its response is known, named
+// by Config.NameTemplate or Config.NameSources and placed according to Config.Layout
+func (downloader *Downloader) resolveOutputPath(resolvedURL string) string {
+	if downloader.NameTemplate != nil {
+		name, err := renderName(downloader.NameTemplate, downloader.nameFields(resolvedURL), resolvedURL)
+		if err == nil {
+			return downloader.outputPathForName(resolvedURL, name)
+		}
+		slog.Warn("Name template failed; using default name", "url", resolvedURL, "error", err)
+	}
+	return downloader.outputPathForName(resolvedURL, downloader.filenameFor(resolvedURL, nil))
+}
+
+// Returns the output path for a document from finalURL saved under the given name.
+// By host, the URL's host and path are mirrored, so distinct URLs keep distinct
+// paths. Flat, a name already taken by another URL (in this run or, according
+// to the metadata, an earlier one) gets a suffix hashed from finalURL, so the
+// same URL always lands on the same file and neither document is lost.
+func (downloader *Downloader) outputPathForName(finalURL, name string) string {
+	filename := downloader.FilenameCase.apply(name)
+	if downloader.Layout == LayoutByHost {
+		return filepath.Join(downloader.OutputDir, mirroredDirectory(finalURL), filename)
+	}
+	filePath := filepath.Join(downloader.OutputDir, filename)
+	hashed := hashedPath(filePath, finalURL)
+	if downloader.ownedByOtherURL(filePath, finalURL) || downloader.metadata.source(hashed) == finalURL {
+		return hashed // Also once the plain name is free again, so the URL keeps its file
+	}
+	return filePath
+}
+
+// Returns where a new document from finalURL is saved when filePath may have
+// been taken since the download started: filePath if it is free, or else the
+// URL-hashed path outputPathForName gives names owned by another URL. The
+// duplicate result is set when the path already holds this exact document.
+func freePath(filePath, finalURL string, size int64, sha256 string) (string, bool) {
+	hashed := hashedPath(filePath, finalURL)
+	for _, candidate := range []string{filePath, hashed} {
+		info, err := os.Stat(candidate)
+		if err != nil {
+			return candidate, false
+		}
+		if info.Size() == size {
+			if existing, err := fileSHA256(candidate); err == nil && existing == sha256 {
+				return candidate, true
+			}
+		}
+	}
+	return hashed, false // An older copy from the same URL, which this one replaces
+}
+
+// Reports whether filePath belongs to a URL other than finalURL
+func (downloader *Downloader) ownedByOtherURL(filePath, finalURL string) bool {
+	owner, claimed := downloader.claims.ownerOf(filePath)
+	if !claimed {
+		owner = downloader.metadata.source(filePath)
+	}
+	return owner != "" && owner != finalURL
+}
+
+// Returns the relative directory mirroring a URL's host and path
+// (e.g. "http://www.docs.citgo.com/msds_pi/C10005B.pdf" → "www.docs.citgo.com/msds_pi")
+func mirroredDirectory(finalURL string) string {
+	parsedURL, err := url.Parse(finalURL)
+	if err != nil {
+		return ""
+	}
+	// Cleaning a rooted path drops any ".." segments, so the result can't escape OutputDir
+	directory := path.Dir(path.Clean("/" + parsedURL.Path))
+	return filepath.Join(parsedURL.Hostname(), filepath.FromSlash(directory))
+}
+
+// Returns the sanitized filename from a Content-Disposition header, or "" when the
+// header is absent or carries no usable filename
+func contentDispositionFilename(header http.Header) string {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSpace(params["filename"]) // Also set from a decoded "filename*"
+	if name == "" {
+		return ""
+	}
+	return pathFilename(name) // Strip any directories and unsafe characters
+}
+
+// Reports whether the response's Last-Modified date is older than since; a
+// missing or unparsable date never counts as old
+func modifiedBefore(resp *http.Response, since time.Time) bool {
+	if since.IsZero() {
+		return false
+	}
+	lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return err == nil && lastModified.Before(since)
+}
+
+// Reports whether a response with the given status carries the whole document
+func (downloader *Downloader) acceptsStatus(statusCode int) bool {
+	accepted := downloader.AcceptStatus
+	if len(accepted) == 0 {
+		accepted = DefaultAcceptStatus
+	}
+	return slices.Contains(accepted, statusCode)
+}
+
+// Reports whether the Content-Type header matches one of the accepted types
+func (downloader *Downloader) acceptsContentType(contentType string) bool {
+	accepted := downloader.ContentTypes
+	if len(accepted) == 0 {
+		accepted = DefaultContentTypes
+	}
+	contentType = strings.ToLower(contentType)
+	for _, candidate := range accepted {
+		if strings.Contains(contentType, strings.ToLower(candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the body starts with the "%PDF-" signature, whatever the server
+// claims its type is; the peeked bytes are still returned by later reads
+func hasPDFMagic(body *bufio.Reader) bool {
+	magic, _ := body.Peek(len(pdfMagic))
+	return bytes.Equal(magic, pdfMagic)
+}
+
+// Signature every PDF file starts with
+var pdfMagic = []byte("%PDF-")
+
+// Reports whether the body starts like an HTML page, after any byte order mark
+// and whitespace; the peeked bytes are still returned by later reads
+func hasHTMLStart(body *bufio.Reader) bool {
+	start, _ := body.Peek(512)
+	start = bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\xef\xbb\xbf")), " \t\r\n")
+	for _, marker := range []string{"<!doctype html", "<html"} {
+		if len(start) >= len(marker) && strings.EqualFold(string(start[:len(marker)]), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether Verify is set and the file at filePath no longer matches the
+// checksum recorded when it was saved. Files without a recorded checksum pass.
+func (downloader *Downloader) corrupted(filePath string) bool {
+	if !downloader.Verify {
+		return false
+	}
+	recorded := downloader.metadata.digest(filePath)
+	if recorded == "" {
+		return false
+	}
+	actual, err := fileSHA256(filePath)
+	if err != nil || actual != recorded {
+		slog.Warn("Local file does not match its recorded checksum, downloading again", "path", filePath)
+		return true
+	}
+	return false
+}
+
+// WriteChecksums writes sha256sums.txt-style lines for every PDF saved in
+// OutputDir (by this or earlier runs) to path, so "sha256sum -c" run inside
+// OutputDir can verify them
+func (downloader *Downloader) WriteChecksums(path string) error {
+	return downloader.metadata.writeChecksums(path)
+}
+
+// Reports whether filePath already holds this URL's document from an earlier run
+// and claims it if so. A path written by a different URL during this run is a
+// name collision rather than a match, so it is not skipped.
+func (downloader *Downloader) alreadyDownloaded(filePath, finalURL string) bool {
+	owner, claimed := downloader.claims.ownerOf(filePath)
+	if FileExists(filePath) && (!claimed || owner == finalURL) {
+		downloader.claims.claim(filePath, finalURL)
+		return true
+	}
+	return false
+}
+
+// Download fetches the PDF at finalURL and saves it in the output directory,
+// counting the outcome in Stats. Cancelling ctx aborts the transfer without
+// leaving a partial file behind. Failures are returned as a *DownloadError.
+func (downloader *Downloader) Download(ctx context.Context, finalURL string) (Result, error) {
+	finalURL = downloader.StripCredentials(finalURL)
+	result, err := downloader.downloadWithRetries(ctx, finalURL)
+	if mirrorURL, ok := downloader.mirrorURL(finalURL); ok && err != nil && mirrorable(ctx, err) {
+		result, err = downloader.downloadFromMirror(ctx, finalURL, mirrorURL, err)
+	}
+	downloader.Stats.Record(result.Status, result.Bytes)
+	return result, classify(finalURL, err, KindNetwork)
+}
+
+// Downloads finalURL, retrying transient failures such as a dropped connection,
+// a 5xx or 429 answer or a truncated body up to Config.DownloadRetries times
+// with exponential backoff. An interrupted transfer resumes from its partial file.
+func (downloader *Downloader) downloadWithRetries(ctx context.Context, finalURL string) (Result, error) {
+	delay := downloader.DownloadBackoff
+	for attempt := 1; ; attempt++ {
+		release, err := downloader.startRequest(ctx, finalURL)
+		if err != nil {
+			return Result{URL: finalURL, Path: downloader.resolveOutputPath(finalURL), Status: StatusFailed}, err
+		}
+		result, err := downloader.download(ctx, finalURL, finalURL)
+		release()
+		if err == nil || attempt > downloader.DownloadRetries || !retryableDownload(ctx, err, delay) {
+			return result, err
+		}
+		slog.Info("Retrying download", "url", finalURL, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Reports whether a failed download is worth another attempt after delay:
+// network failures, timeouts, truncated bodies and 5xx or 429 answers are,
+// while rejected content and other HTTP errors will fail the same way again
+func retryableDownload(ctx context.Context, err error, delay time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	switch kindOf(err, KindNetwork) {
+	case KindNetwork, KindTimeout, KindEmpty:
+		return true
+	}
+	return false
+}
+
+// Does the work of Download without touching Stats, requesting the document
+// from fetchURL, which is finalURL itself unless a mirror stands in for it
+func (downloader *Downloader) download(ctx context.Context, finalURL, fetchURL string) (Result, error) {
+	filePath := downloader.claimOutputPath(finalURL)
+	result, err := downloader.downloadTo(ctx, filePath, finalURL, fetchURL, false)
+	if err != nil || (result.Path != filePath && downloader.savesLocally()) { // Leave a name that holds nothing of this URL to others
+		downloader.releaseOutputPath(filePath, finalURL)
+	}
+	return result, err
+}
+
+// Picks the output path of finalURL and claims it before anything is written,
+// so a colliding URL downloaded at the same time gets its hashed name, and its
+// own ".part" file, instead of writing into this one
+func (downloader *Downloader) claimOutputPath(finalURL string) string {
+	downloader.writeMu.Lock()
+	defer downloader.writeMu.Unlock()
+	filePath := downloader.resolveOutputPath(finalURL)
+	downloader.claims.claim(filePath, finalURL)
+	return filePath
+}
+
+// Gives up the claim of finalURL on filePath unless a file was saved there
+func (downloader *Downloader) releaseOutputPath(filePath, finalURL string) {
+	downloader.writeMu.Lock()
+	defer downloader.writeMu.Unlock()
+	if !FileExists(filePath) {
+		downloader.claims.release(filePath, finalURL)
+	}
+}
+
+// Downloads finalURL into filePath, the path claimed for it, or into the name
+// the response gives it. With noResume, a partial file left by an earlier
+// attempt is overwritten instead of resumed.
+func (downloader *Downloader) downloadTo(ctx context.Context, filePath, finalURL, fetchURL string, noResume bool) (Result, error) {
+	result := Result{URL: finalURL, Path: filePath, Status: StatusFailed}
+
+	// Skip if file already exists; refresh mode checks the server for changes first
+	existing := downloader.savesLocally() && downloader.alreadyDownloaded(filePath, finalURL)
+	replace := downloader.Overwrite || (existing && downloader.corrupted(filePath))
+	if existing && !downloader.Refresh && !replace {
+		downloader.metadata.adopt(filePath, finalURL)
+		result.Status = StatusSkipped
+		return result, nil
+	}
+
+	// Create a new request so we can set headers; cancelling ctx aborts it mid-transfer
+	req, err := downloader.newRequest(ctx, "GET", fetchURL)
+	if err != nil {
+		return result, err
+	}
+
+	// Pick up where an interrupted earlier download of a new file stopped
+	partialPath := filePath + ".part"
+	var offset int64
+	if !existing && downloader.Sink == nil && !noResume { // A sink keeps no partial file to resume
+		offset = partialSize(partialPath)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if !downloader.Since.IsZero() { // Let the server answer 304 for documents older than -since
+		req.Header.Set("If-Modified-Since", downloader.Since.UTC().Format(http.TimeFormat))
+	}
+
+	// Send the request
+	resp, err := downloader.HTTPClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close() // Ensure response body is closed
+
+	expectedSize := int64(-1) // Full document size announced by a resumed response
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		expectedSize, err = checkContentRange(resp, offset)
+		if err != nil {
+			discardPartial(partialPath) // Unusable for resuming, so start over next time
+			return result, fmt.Errorf("resume download: %w", err)
+		}
+		slog.Debug("Resuming partial download", "url", finalURL, "offset", offset)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		resp.Body.Close()
+		discardPartial(partialPath) // The partial file no longer matches the document
+		slog.Debug("Server can't resume partial download, starting over", "url", finalURL, "offset", offset)
+		return downloader.downloadTo(ctx, filePath, finalURL, fetchURL, true) // Once, without a Range header
+	case resp.StatusCode == http.StatusNotModified && !downloader.Since.IsZero():
+		result.Status = StatusSkipped // Not updated since -since
+		return result, nil
+	case downloader.acceptsStatus(resp.StatusCode):
+		offset = 0 // The server ignored any Range header and sent everything
+	default:
+		return result, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	// The transport only decompresses bodies it asked for compressed itself, not
+	// those of requests carrying their own Accept-Encoding or a Range header
+	if gzipEncoded(resp) {
+		if offset > 0 { // The partial file holds decoded bytes, which a compressed range doesn't continue
+			resp.Body.Close()
+			discardPartial(partialPath)
+			return downloader.downloadTo(ctx, filePath, finalURL, fetchURL, true) // Once, without a Range header
+		}
+		if err := decodeGzip(resp); err != nil {
+			return result, err
+		}
+	}
+
+	// Servers that ignore If-Modified-Since still report the date
+	if modifiedBefore(resp, downloader.Since) {
+		result.Status = StatusSkipped
+		return result, nil
+	}
+
+	// Lets the magic bytes be inspected before copying; a resumed body continues
+	// the bytes already in the partial file, which are read back from disk
+	var resumed io.Reader = strings.NewReader("")
+	if offset > 0 {
+		partialFile, err := os.Open(partialPath)
+		if err != nil {
+			return result, fmt.Errorf("open partial file: %w", err)
+		}
+		defer partialFile.Close()
+		resumed = io.LimitReader(partialFile, offset)
+	}
+	body := bufio.NewReader(io.MultiReader(resumed, downloader.throttle(ctx, resp.Body)))
+	contentType := resp.Header.Get("Content-Type") // Get content type of response
+	if !downloader.acceptsContentType(contentType) {
+		if !hasPDFMagic(body) || (downloader.DistrustMagic && contentType != "") {
+			result.Status = StatusInvalidContentType
+			return result, fmt.Errorf("%w: %q", ErrInvalidContentType, contentType)
+		}
+		// Missing or wrong headers are common; the signature settles it
+		slog.Debug("Accepting body that starts with %PDF- despite its Content-Type", "url", finalURL, "content_type", contentType)
+	} else if documentExtension(contentType, finalURL, body) == ".pdf" && !hasPDFMagic(body) &&
+		(genericContentType(contentType) || hasHTMLStart(body)) {
+		// A generic type says nothing, so a body to be saved as a PDF must prove it
+		// is one; an HTML page claiming to be a PDF never is
+		result.Status = StatusInvalidContentType
+		return result, fmt.Errorf("%w: served as %q", ErrNotPDF, contentType)
+	}
+
+	// With the response at hand, the server's filename can take part in naming
+	// (by default it beats the URL), and the download is skipped before reading
+	// the body if that file exists. An explicit -name-template always wins.
+	renamed := filePath
+	if downloader.NameTemplate == nil {
+		renamed = downloader.outputPathForName(finalURL, downloader.filenameFor(finalURL, resp.Header))
+	}
+	// Accepted non-PDF documents (e.g. Word files) keep their own extension
+	renamed = withExtension(renamed, documentExtension(contentType, finalURL, body))
+	if renamed != filePath {
+		filePath = renamed
+		result.Path = filePath
+		existing = downloader.savesLocally() && downloader.alreadyDownloaded(filePath, finalURL)
+		replace = downloader.Overwrite || (existing && downloader.corrupted(filePath))
+		if existing && !downloader.Refresh && !replace {
+			downloader.metadata.adopt(filePath, finalURL)
+			result.Status = StatusSkipped
+			return result, nil
+		}
+	}
+
+	// In refresh mode, keep the local copy when the server reports the same document
+	if existing && !replace && downloader.metadata.unchanged(filePath, resp) {
+		result.Status = StatusSkipped
+		return result, nil
+	}
+
+	if downloader.MaxSize > 0 && resp.ContentLength > downloader.MaxSize-offset { // Refuse before reading anything
+		return result, fmt.Errorf("%w: announced %d bytes, limit is %d", ErrTooLarge, offset+resp.ContentLength, downloader.MaxSize)
+	}
+
+	if downloader.Sink != nil {
+		return downloader.saveToSink(result, body)
+	}
+
+	// Stream the body straight into the ".part" file next to filePath, hashing it
+	// on the way, so memory use stays flat however large or numerous the downloads
+	if err := CreateDirectory(filepath.Dir(partialPath), 0o755); err != nil { // Mirrored paths need their parents
+		return result, fmt.Errorf("create directory: %w", err)
+	}
+	if resp.ContentLength > 0 { // Don't start a transfer that can't fit
+		if err := downloader.CheckFreeSpace(filepath.Dir(partialPath), uint64(resp.ContentLength)); err != nil {
+			return result, err
+		}
+	}
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_RDWR | os.O_APPEND // New bytes continue the partial file
+	}
+	part, err := os.OpenFile(partialPath, flags, 0o644)
+	if err != nil {
+		return result, fmt.Errorf("create partial file: %w", err)
+	}
+	defer part.Close()
+	digest := sha256.New() // Checksum computed while the body streams in
+	if _, err := io.CopyN(digest, body, offset); err != nil {
+		discardPartial(partialPath)
+		return result, fmt.Errorf("read partial file: %w", err)
+	}
+	var limited io.Reader = body
+	if downloader.MaxSize > 0 { // One byte over the limit tells a huge body apart from one that fits exactly
+		limited = io.LimitReader(body, downloader.MaxSize-offset+1)
+	}
+	written, err := io.Copy(io.MultiWriter(part, digest), limited) // Copy data to disk
+	written += offset
+	if err != nil {
+		keepPartial(partialPath, resp, written) // Let the next run resume the transfer
+		return result, fmt.Errorf("read PDF data: %w", err)
+	}
+	if err := downloader.checkSize(written, expectedSize); err != nil {
+		discardPartial(partialPath)
+		return result, err
+	}
+	if err := part.Sync(); err != nil { // Flush to disk before the rename makes it visible
+		discardPartial(partialPath)
+		return result, fmt.Errorf("write PDF to file: %w", err)
+	}
+
+	result.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	if recorded := downloader.metadata.digest(filePath); downloader.Verify && recorded != "" && recorded != result.SHA256 {
+		slog.Info("Document differs from its recorded checksum", "url", finalURL, "path", filePath)
+	}
+
+	if downloader.ValidatePDF && getFileExtension(filePath) == ".pdf" { // Catch corrupt and encrypted files
+		if err := validatePDF(part, written); err != nil {
+			part.Close()
+			if quarantinePath, quarantineErr := downloader.quarantine(partialPath, filePath, written, result.SHA256); quarantineErr != nil {
+				slog.Warn("Failed to quarantine invalid PDF", "path", filePath, "error", quarantineErr)
+				discardPartial(partialPath)
+			} else {
+				result.Path = quarantinePath
+			}
+			return result, err
+		}
+	}
+
+	if downloader.Archive != nil { // Archive mode collects the PDFs in a zip instead
+		defer discardPartial(partialPath)
+		return downloader.addToArchive(result, part, written)
+	}
+
+	// Choosing a free name and moving the file there must not interleave with another download
+	downloader.writeMu.Lock()
+	defer downloader.writeMu.Unlock()
+
+	if !existing { // A refreshed or overwritten file replaces its old copy; anything else must not
+		var duplicate bool
+		filePath, duplicate = freePath(filePath, finalURL, written, result.SHA256) // Never overwrite another URL's document
+		result.Path = filePath
+		if duplicate {
+			discardPartial(partialPath)
+			result.Status = StatusSkipped
+			return result, nil
+		}
+	}
+	downloader.claims.claim(filePath, finalURL)
+
+	part.Close()
+	if err := os.Rename(partialPath, filePath); err != nil { // Only complete PDFs reach filePath
+		discardPartial(partialPath)
+		return result, fmt.Errorf("write PDF to file: %w", err)
+	}
+	downloader.metadata.record(filePath, finalURL, resp.Header, written, result.SHA256) // Baseline for future refreshes
+
+	result.Status = StatusDownloaded
+	result.Bytes = written
+	result.Replaced = existing
+	return result, nil
+}
+
+// Creates a request for finalURL carrying the User-Agent the browser used while
+// resolving it, the configured headers and cookies and the host's credentials
+func (downloader *Downloader) newRequest(ctx context.Context, method, finalURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, finalURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", downloader.agents.forURL(finalURL))
+	for key, values := range downloader.Headers { // Credentials for gated endpoints
+		req.Header[key] = values
+	}
+	for _, cookie := range downloader.Cookies {
+		req.AddCookie(cookie)
+	}
+	if credentials, ok := downloader.credentialsFor(finalURL); ok && req.Header.Get("Authorization") == "" {
+		req.SetBasicAuth(credentials.Username, credentials.Password) // An explicit Authorization header wins
+	}
+	return req, nil
+}
+
+// Reports whether documents are saved as files in OutputDir rather than to
+// the Archive or a Sink
+func (downloader *Downloader) savesLocally() bool {
+	return downloader.Archive == nil && downloader.Sink == nil
+}
+
+// Reports whether a response body is still gzip-compressed
+func gzipEncoded(resp *http.Response) bool {
+	return !resp.Uncompressed && strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), "gzip")
+}
+
+// Replaces a gzip-compressed body with its decompressed bytes and, like the
+// transport does, drops the encoding headers and the compressed length
+func decodeGzip(resp *http.Response) error {
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("decompress gzip body: %w", err)
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// Checks the size of a finished transfer against the size a resumed response
+// announced and the Config.MinSize and Config.MaxSize limits
+func (downloader *Downloader) checkSize(written, expectedSize int64) error {
+	if downloader.MaxSize > 0 && written > downloader.MaxSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrTooLarge, downloader.MaxSize)
+	}
+	if expectedSize >= 0 && written != expectedSize {
+		return fmt.Errorf("resumed download has %d bytes, expected %d", written, expectedSize)
+	}
+	if written < max(downloader.MinSize, 1) { // Empty or truncated bodies are never saved
+		return fmt.Errorf("%w: got %d bytes, need at least %d", ErrTooSmall, written, max(downloader.MinSize, 1))
+	}
+	return nil
+}
+
+// Adds a downloaded PDF to the archive under its path relative to OutputDir,
+// skipping it when another URL already produced an entry of that name
+func (downloader *Downloader) addToArchive(result Result, content io.ReadSeeker, size int64) (Result, error) {
+	name, err := filepath.Rel(downloader.OutputDir, result.Path)
+	if err != nil {
+		name = filepath.Base(result.Path)
+	}
+	result.Path = filepath.ToSlash(name) // Zip entries always use forward slashes
+
+	if err := downloader.CheckFreeSpace(filepath.Dir(downloader.Archive.path), uint64(size)); err != nil {
+		return result, err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return result, fmt.Errorf("add PDF to archive: %w", err)
+	}
+	added, err := downloader.Archive.Add(result.Path, content)
+	if err != nil {
+		return result, fmt.Errorf("add PDF to archive: %w", err)
+	}
+	if !added {
+		result.Status = StatusSkipped
+		return result, nil
+	}
+	result.Status = StatusDownloaded
+	result.Bytes = size
+	return result, nil
+}
@@ -0,0 +1,584 @@
+package sds
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A small body that passes for a PDF
+const testPDF = "%PDF-1.4\n1 0 obj <<>> endobj\ntrailer <<>>\n%%EOF\n"
+
+// Returns a Downloader saving into a fresh temporary directory, unless config
+// names one, that sends its requests through server
+func newTestDownloader(t *testing.T, server *httptest.Server, config Config) *Downloader {
+	t.Helper()
+	if config.OutputDir == "" {
+		config.OutputDir = t.TempDir()
+	}
+	downloader := New(config)
+	if server != nil {
+		downloader.HTTPClient = server.Client()
+	}
+	t.Cleanup(func() { downloader.Close() })
+	return downloader
+}
+
+// Returns the files under dir, relative to it with forward slashes, leaving
+// out the downloader's hidden bookkeeping files
+func savedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".sds-") {
+			return err
+		}
+		relative, _ := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(relative))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestDownload(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/valid.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(testPDF))
+	})
+	mux.HandleFunc("/missing.pdf", http.NotFound)
+	mux.HandleFunc("/error.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("<!DOCTYPE html>\n<html><body>Session expired</body></html>"))
+	})
+	mux.HandleFunc("/empty.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+	})
+	mux.HandleFunc("/moved.pdf", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/valid.pdf", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path   string
+		status Status
+		kind   ErrorKind // "" for success
+		saved  string    // File left in the output directory ("" for none)
+	}{
+		{"/valid.pdf", StatusDownloaded, "", "valid.pdf"},
+		{"/missing.pdf", StatusFailed, KindHTTPStatus, ""},
+		{"/error.pdf", StatusInvalidContentType, KindNotPDF, ""},
+		{"/empty.pdf", StatusFailed, KindEmpty, ""},
+		{"/moved.pdf", StatusDownloaded, "", "moved.pdf"}, // Named after the URL asked for
+	}
+	for _, test := range tests {
+		t.Run(strings.TrimPrefix(test.path, "/"), func(t *testing.T) {
+			downloader := newTestDownloader(t, server, Config{})
+			result, err := downloader.Download(context.Background(), server.URL+test.path)
+			if result.Status != test.status {
+				t.Errorf("status = %v, want %v", result.Status, test.status)
+			}
+			if kind := ErrorKindOf(err); kind != test.kind {
+				t.Errorf("error kind = %q, want %q (error %v)", kind, test.kind, err)
+			}
+			files := savedFiles(t, downloader.OutputDir)
+			if test.saved == "" {
+				if len(files) > 0 {
+					t.Errorf("left %v on disk, want nothing", files)
+				}
+				return
+			}
+			if len(files) != 1 || files[0] != test.saved {
+				t.Fatalf("saved %v, want [%s]", files, test.saved)
+			}
+			content, err := os.ReadFile(filepath.Join(downloader.OutputDir, test.saved))
+			if err != nil || string(content) != testPDF {
+				t.Errorf("saved content %q (error %v), want the PDF", content, err)
+			}
+		})
+	}
+}
+
+func TestDownloadConcurrentCollision(t *testing.T) {
+	bodies := map[string]string{
+		"/a/doc.pdf": testPDF + strings.Repeat("a", 256<<10),
+		"/b/doc.pdf": testPDF + strings.Repeat("b", 256<<10),
+	}
+	arrived := make(chan struct{}, len(bodies))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		for len(arrived) < len(bodies) { // Both transfers run at the same time
+			time.Sleep(time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		body := bodies[r.URL.Path]
+		for start := 0; start < len(body); start += 16 << 10 {
+			w.Write([]byte(body[start:min(start+16<<10, len(body))]))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+	downloader := newTestDownloader(t, server, Config{})
+
+	var wg sync.WaitGroup
+	results := make(map[string]Result)
+	var mu sync.Mutex
+	for path := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := downloader.Download(context.Background(), server.URL+path)
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+			}
+			mu.Lock()
+			results[path] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if results["/a/doc.pdf"].Path == results["/b/doc.pdf"].Path {
+		t.Fatalf("both URLs saved to %s", results["/a/doc.pdf"].Path)
+	}
+	for path, result := range results {
+		content, err := os.ReadFile(result.Path)
+		if err != nil || string(content) != bodies[path] {
+			t.Errorf("%s: %s holds %d bytes not matching its body (error %v)", path, result.Path, len(content), err)
+		}
+	}
+	if files := savedFiles(t, downloader.OutputDir); len(files) != 2 {
+		t.Errorf("left %v on disk, want the two documents", files)
+	}
+}
+
+func TestDownloadGzipEncoded(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(testPDF))
+	writer.Close()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Encoding", "gzip") // Even when the client didn't ask for it
+		if r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 5-%d/%d", compressed.Len()-1, compressed.Len()))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(compressed.Bytes()[5:])
+			return
+		}
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		headers  http.Header // Sent with the request; an own Accept-Encoding stops the transport from decoding
+		partial  bool        // Start with a partial file, which a compressed range can't continue
+		requests int32
+	}{
+		{"decoded by the transport", nil, false, 1},
+		{"own Accept-Encoding", http.Header{"Accept-Encoding": {"gzip"}}, false, 1},
+		{"resumed", nil, true, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests.Store(0)
+			downloader := newTestDownloader(t, server, Config{Headers: test.headers})
+			if test.partial {
+				os.WriteFile(filepath.Join(downloader.OutputDir, "doc.pdf.part"), []byte(testPDF[:5]), 0o644)
+			}
+			result, err := downloader.Download(context.Background(), server.URL+"/doc.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(result.Path)
+			if err != nil || string(content) != testPDF {
+				t.Errorf("saved %q (error %v), want the decoded document", content, err)
+			}
+			if result.Bytes != int64(len(testPDF)) {
+				t.Errorf("counted %d bytes, want %d", result.Bytes, len(testPDF))
+			}
+			if got := requests.Load(); got != test.requests {
+				t.Errorf("server saw %d requests, want %d", got, test.requests)
+			}
+		})
+	}
+}
+
+func TestDownloadOctetStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status Status
+		err    error // nil for success
+	}{
+		{"html", "<html><body>Please log in</body></html>", StatusInvalidContentType, ErrNotPDF},
+		{"pdf", testPDF, StatusDownloaded, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "binary/octet-stream")
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			downloader := newTestDownloader(t, server, Config{})
+
+			result, err := downloader.Download(context.Background(), server.URL+"/C10005B.pdf")
+			if result.Status != test.status || !errors.Is(err, test.err) {
+				t.Fatalf("status = %v, error = %v; want %v, %v", result.Status, err, test.status, test.err)
+			}
+			files := savedFiles(t, downloader.OutputDir)
+			if test.err != nil {
+				if kind := ErrorKindOf(err); kind != KindNotPDF {
+					t.Errorf("error kind = %q, want %q", kind, KindNotPDF)
+				}
+				if len(files) > 0 {
+					t.Errorf("left %v on disk, want nothing", files)
+				}
+				return
+			}
+			if len(files) != 1 || files[0] != "c10005b.pdf" {
+				t.Errorf("saved %v, want [c10005b.pdf]", files)
+			}
+		})
+	}
+}
+
+func TestDownloadAcceptStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.WriteHeader(http.StatusNonAuthoritativeInfo) // 203 from a caching CDN
+		w.Write([]byte(testPDF))
+	}))
+	defer server.Close()
+
+	downloader := newTestDownloader(t, server, Config{AcceptStatus: []int{200, 203}})
+	if result, err := downloader.Download(context.Background(), server.URL+"/doc.pdf"); err != nil || result.Status != StatusDownloaded {
+		t.Errorf("with 203 accepted: status = %v, error = %v; want downloaded", result.Status, err)
+	}
+
+	downloader = newTestDownloader(t, server, Config{})
+	result, err := downloader.Download(context.Background(), server.URL+"/doc.pdf")
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNonAuthoritativeInfo {
+		t.Fatalf("by default: error = %v, want an HTTPStatusError for 203", err)
+	}
+	if result.Status != StatusFailed || len(savedFiles(t, downloader.OutputDir)) > 0 {
+		t.Errorf("by default: status = %v, want failed with nothing saved", result.Status)
+	}
+}
+
+func TestResolveOutputPath(t *testing.T) {
+	const (
+		citgoURL  = "http://www.docs.citgo.com/msds_pi/C10005B.pdf"
+		mirrorURL = "https://mirror.example/msds_pi/C10005B.pdf" // Same filename, another host
+	)
+	tests := []struct {
+		layout Layout
+		citgo  string // Path of citgoURL, relative to OutputDir with forward slashes
+		mirror string // Path of mirrorURL, claimed after citgoURL
+	}{
+		{LayoutFlat, "c10005b.pdf", "c10005b" + urlHashSuffix(mirrorURL) + ".pdf"},
+		{LayoutByHost, "www.docs.citgo.com/msds_pi/c10005b.pdf", "mirror.example/msds_pi/c10005b.pdf"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.layout), func(t *testing.T) {
+			downloader := newTestDownloader(t, nil, Config{Layout: test.layout})
+			relative := func(path string) string {
+				relativePath, _ := filepath.Rel(downloader.OutputDir, path)
+				return filepath.ToSlash(relativePath)
+			}
+			if got := relative(downloader.claimOutputPath(citgoURL)); got != test.citgo {
+				t.Errorf("%s → %s, want %s", citgoURL, got, test.citgo)
+			}
+			if got := relative(downloader.claimOutputPath(mirrorURL)); got != test.mirror {
+				t.Errorf("%s → %s, want %s", mirrorURL, got, test.mirror)
+			}
+			// Each URL keeps its path once claimed
+			if got := relative(downloader.resolveOutputPath(citgoURL)); got != test.citgo {
+				t.Errorf("%s again → %s, want %s", citgoURL, got, test.citgo)
+			}
+			if got := relative(downloader.resolveOutputPath(mirrorURL)); got != test.mirror {
+				t.Errorf("%s again → %s, want %s", mirrorURL, got, test.mirror)
+			}
+		})
+	}
+}
+
+func TestDownloadRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(testPDF))
+	}))
+	defer server.Close()
+	downloader := newTestDownloader(t, server, Config{DownloadRetries: 2, DownloadBackoff: 10 * time.Millisecond})
+
+	result, err := downloader.Download(context.Background(), server.URL+"/C10005B.pdf")
+	if err != nil || result.Status != StatusDownloaded {
+		t.Fatalf("status = %v, error = %v; want downloaded", result.Status, err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+	if content, err := os.ReadFile(result.Path); err != nil || string(content) != testPDF {
+		t.Errorf("saved %q (error %v), want the document", content, err)
+	}
+}
+
+func TestDownloadCollidingNames(t *testing.T) {
+	bodies := map[string]string{
+		"/lubricants/C10139.pdf": testPDF + "% lubricants\n",
+		"/fuels/C10139.pdf":      testPDF + "% fuels\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(bodies[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	for _, sameRun := range []bool{true, false} {
+		t.Run(fmt.Sprintf("same run %v", sameRun), func(t *testing.T) {
+			downloader := newTestDownloader(t, server, Config{})
+			first, err := downloader.Download(context.Background(), server.URL+"/lubricants/C10139.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameRun { // A later run over the same directory
+				downloader.Close()
+				downloader = newTestDownloader(t, server, Config{OutputDir: downloader.OutputDir})
+			}
+			second, err := downloader.Download(context.Background(), server.URL+"/fuels/C10139.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Path == second.Path || second.Status != StatusDownloaded {
+				t.Fatalf("second document: %s (%v), want its own file next to %s", second.Path, second.Status, first.Path)
+			}
+			for path, result := range map[string]Result{"/lubricants/C10139.pdf": first, "/fuels/C10139.pdf": second} {
+				if content, err := os.ReadFile(result.Path); err != nil || string(content) != bodies[path] {
+					t.Errorf("%s holds %q (error %v), want the body of %s", result.Path, content, err, path)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string   // Sent by the server
+		body        string   // Sent by the server
+		accepted    []string // Config.ContentTypes (the defaults if nil)
+		err         error    // nil for success
+	}{
+		{"default pdf", "application/pdf", testPDF, nil, nil},
+		{"default pdf with parameters", "application/pdf; charset=binary", testPDF, nil, nil},
+		{"default octet-stream", "binary/octet-stream", testPDF, nil, nil},
+		{"configured x-pdf", "application/x-pdf", testPDF, []string{"application/x-pdf"}, nil},
+		{"configured download", "application/download", testPDF, []string{"application/pdf", "application/download"}, nil},
+		{"configured list replaces defaults", "application/pdf", "not a pdf", []string{"application/x-pdf"}, ErrInvalidContentType},
+		{"unlisted type with magic", "text/plain", testPDF, nil, nil},
+		{"unlisted type without magic", "application/x-pdf", "not a pdf", nil, ErrInvalidContentType},
+		{"html", "text/html", "<html><body>Not found</body></html>", nil, ErrInvalidContentType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			downloader := newTestDownloader(t, server, Config{ContentTypes: test.accepted})
+
+			result, err := downloader.Download(context.Background(), server.URL+"/C10005B.pdf")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			files := savedFiles(t, downloader.OutputDir)
+			if test.err != nil {
+				if result.Status != StatusInvalidContentType || len(files) > 0 {
+					t.Errorf("status = %v with %v on disk, want invalid content type and nothing saved", result.Status, files)
+				}
+				return
+			}
+			if result.Status != StatusDownloaded || len(files) != 1 || files[0] != "c10005b.pdf" {
+				t.Errorf("status = %v with %v on disk, want [c10005b.pdf] downloaded", result.Status, files)
+			}
+		})
+	}
+}
+
+func TestDownloadMissingContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		kind ErrorKind // "" for success
+	}{
+		{"pdf", testPDF, ""},
+		{"html", "<html><body>Please log in</body></html>", KindContentType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Content-Type"] = nil // Stops net/http from sniffing one
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			downloader := newTestDownloader(t, server, Config{})
+
+			result, err := downloader.Download(context.Background(), server.URL+"/C10005B.pdf")
+			if kind := ErrorKindOf(err); kind != test.kind {
+				t.Fatalf("error kind = %q (%v), want %q", kind, err, test.kind)
+			}
+			files := savedFiles(t, downloader.OutputDir)
+			if test.kind != "" {
+				if result.Status != StatusInvalidContentType || len(files) > 0 {
+					t.Errorf("status = %v with %v on disk, want invalid content type and nothing saved", result.Status, files)
+				}
+				return
+			}
+			if result.Status != StatusDownloaded || len(files) != 1 || files[0] != "c10005b.pdf" {
+				t.Errorf("status = %v with %v on disk, want [c10005b.pdf] downloaded", result.Status, files)
+			}
+		})
+	}
+}
+
+func TestDownloadDistrustMagic(t *testing.T) {
+	tests := []struct {
+		contentType string // Sent by the server ("" for no header)
+		distrust    bool   // Config.DistrustMagic
+		ok          bool
+	}{
+		{"text/plain", false, true},
+		{"text/plain", true, false},
+		{"", false, true},
+		{"", true, true}, // A missing header still falls back to the signature
+		{"application/pdf", true, true},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%q distrust %v", test.contentType, test.distrust), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentType == "" {
+					w.Header()["Content-Type"] = nil // Stops net/http from sniffing one
+				} else {
+					w.Header().Set("Content-Type", test.contentType)
+				}
+				w.Write([]byte(testPDF))
+			}))
+			defer server.Close()
+			downloader := newTestDownloader(t, server, Config{DistrustMagic: test.distrust})
+
+			result, err := downloader.Download(context.Background(), server.URL+"/C10005B.pdf")
+			if test.ok {
+				if err != nil || result.Status != StatusDownloaded {
+					t.Errorf("status = %v, error = %v; want downloaded", result.Status, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidContentType) || len(savedFiles(t, downloader.OutputDir)) > 0 {
+				t.Errorf("status = %v, error = %v; want rejected with nothing saved", result.Status, err)
+			}
+		})
+	}
+}
+
+func TestFreePathKeepsURLName(t *testing.T) {
+	const sourceURL = "https://mirror.example/msds_pi/C10139.pdf"
+	downloader := newTestDownloader(t, nil, Config{})
+	filePath := filepath.Join(downloader.OutputDir, "c10139.pdf")
+	hashed := filepath.Join(downloader.OutputDir, "c10139"+urlHashSuffix(sourceURL)+".pdf")
+	const document = testPDF + "% mirror\n"
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(document)))
+
+	// Another document without any metadata took the name meanwhile
+	os.WriteFile(filePath, []byte(testPDF), 0o644)
+	if path, duplicate := freePath(filePath, sourceURL, int64(len(document)), digest); path != hashed || duplicate {
+		t.Fatalf("freePath = %s, %v; want %s", path, duplicate, hashed)
+	}
+	os.WriteFile(hashed, []byte(document), 0o644)
+	downloader.metadata.record(hashed, sourceURL, nil, int64(len(document)), digest)
+
+	// The same hashed name every time, not a numbered one
+	if path, duplicate := freePath(filePath, sourceURL, int64(len(document)), digest); path != hashed || !duplicate {
+		t.Errorf("freePath again = %s, %v; want %s as a duplicate", path, duplicate, hashed)
+	}
+	if path := downloader.resolveOutputPath(sourceURL); path != hashed {
+		t.Errorf("resolveOutputPath = %s, want %s where the URL's document is", path, hashed)
+	}
+}
+
+func TestDownloadRecordsExistingFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(testPDF))
+	}))
+	defer server.Close()
+	downloader := newTestDownloader(t, server, Config{})
+	os.WriteFile(filepath.Join(downloader.OutputDir, "c10005b.pdf"), []byte(testPDF), 0o644) // Committed before the metadata existed
+
+	result, err := downloader.Download(context.Background(), server.URL+"/C10005B.pdf")
+	if err != nil || result.Status != StatusSkipped {
+		t.Fatalf("status = %v, error = %v; want the existing file skipped", result.Status, err)
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.csv")
+	if err := downloader.WriteManifest(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "c10005b.pdf" || entries[0].URL != server.URL+"/C10005B.pdf" ||
+		entries[0].Size != int64(len(testPDF)) || entries[0].SHA256 == "" {
+		t.Errorf("manifest = %+v, want the existing file with its URL, size and checksum", entries)
+	}
+}
+
+func TestDownloadSavesMetadataOnClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(testPDF))
+	}))
+	defer server.Close()
+	downloader := newTestDownloader(t, server, Config{})
+
+	for _, name := range []string{"a.pdf", "b.pdf"} {
+		if _, err := downloader.Download(context.Background(), server.URL+"/"+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recorded, _ := RecordedFiles(downloader.OutputDir); len(recorded) != 0 {
+		t.Errorf("metadata on disk before Close = %v, want it kept in memory", recorded)
+	}
+	downloader.Close()
+	recorded, err := RecordedFiles(downloader.OutputDir)
+	if err != nil || !recorded["a.pdf"] || !recorded["b.pdf"] {
+		t.Errorf("metadata on disk after Close = %v, %v; want both files", recorded, err)
+	}
+}
@@ -0,0 +1,123 @@
+package sds
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+)
+
+// ErrorKind is the category of a failed Resolve or Download, for automation
+// that treats failures differently (e.g. retrying network errors but not
+// blocked pages)
+type ErrorKind string
+
+const (
+	KindNetwork      ErrorKind = "network"       // Connection, DNS, TLS or transfer failure
+	KindTimeout      ErrorKind = "timeout"       // A per-URL or run-wide deadline passed
+	KindCanceled     ErrorKind = "canceled"      // The run was interrupted
+	KindHTTPStatus   ErrorKind = "http_status"   // The server answered with an unexpected status
+	KindContentType  ErrorKind = "content_type"  // The response was not a document of an accepted type
+	KindNotPDF       ErrorKind = "not_pdf"       // A body served as binary/octet-stream or as a PDF was not one (e.g. an HTML error page)
+	KindEmpty        ErrorKind = "empty"         // The body was empty or smaller than Config.MinSize
+	KindTooLarge     ErrorKind = "too_large"     // The document exceeded Config.MaxSize
+	KindInvalidPDF   ErrorKind = "invalid_pdf"   // The PDF failed Config.ValidatePDF
+	KindBlocked      ErrorKind = "blocked"       // An access-denied, captcha or login page stood in the way
+	KindRedirectLoop ErrorKind = "redirect_loop" // The pages redirected in a cycle
+	KindBrowser      ErrorKind = "browser"       // Chrome failed to start or to load the page
+	KindFilesystem   ErrorKind = "filesystem"    // The output could not be written
+	KindOther        ErrorKind = "other"         // Anything else
+)
+
+// DownloadError is the error returned by Resolve and Download. It wraps the
+// underlying error, so errors.Is still finds sentinels such as ErrBlocked.
+type DownloadError struct {
+	Kind ErrorKind // Category of the failure
+	URL  string    // URL being resolved or downloaded
+	Err  error     // Underlying error
+}
+
+// Error returns the message of the underlying error
+func (err *DownloadError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (err *DownloadError) Unwrap() error {
+	return err.Err
+}
+
+// HTTPStatusError is returned when a server answers a download with a status
+// outside Config.AcceptStatus that isn't a resumed 206 or an expected 304
+type HTTPStatusError struct {
+	StatusCode int    // Numeric status, e.g. 404
+	Status     string // Status line, e.g. "404 Not Found"
+}
+
+// Error describes the unexpected status
+func (err *HTTPStatusError) Error() string {
+	return "unexpected HTTP status " + err.Status
+}
+
+// ErrorKindOf returns the kind of a failure: that of a DownloadError in its
+// chain, or else one told from its causes. It returns "" for a nil error.
+func ErrorKindOf(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.Kind
+	}
+	return kindOf(err, KindOther)
+}
+
+// Wraps a failure of Resolve or Download in a DownloadError, using fallback
+// when the cause doesn't tell the kind
+func classify(rawURL string, err error, fallback ErrorKind) error {
+	var downloadErr *DownloadError
+	if err == nil || errors.As(err, &downloadErr) {
+		return err
+	}
+	return &DownloadError{Kind: kindOf(err, fallback), URL: rawURL, Err: err}
+}
+
+// Tells the kind of a failure from the sentinels and error types in its chain
+func kindOf(err error, fallback ErrorKind) ErrorKind {
+	var statusErr *HTTPStatusError
+	var netErr net.Error
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return KindCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.Is(err, ErrBlocked):
+		return KindBlocked
+	case errors.Is(err, ErrRedirectLoop):
+		return KindRedirectLoop
+	case errors.Is(err, ErrNotPDF):
+		return KindNotPDF
+	case errors.Is(err, ErrInvalidContentType):
+		return KindContentType
+	case errors.Is(err, ErrTooSmall):
+		return KindEmpty
+	case errors.Is(err, ErrTooLarge):
+		return KindTooLarge
+	case errors.Is(err, ErrInvalidPDF):
+		return KindInvalidPDF
+	case errors.Is(err, ErrLowDiskSpace), errors.As(err, &pathErr):
+		return KindFilesystem
+	case errors.As(err, &statusErr):
+		return KindHTTPStatus
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return KindTimeout
+		}
+		return KindNetwork
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return KindNetwork
+	}
+	return fallback
+}
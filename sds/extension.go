@@ -0,0 +1,77 @@
+package sds
+
+import (
+	"bufio"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Extensions for document types that the system MIME table often lacks
+var documentExtensions = map[string]string{
+	"application/pdf":          ".pdf",
+	"application/msword":       ".doc",
+	"application/vnd.ms-excel": ".xls",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       ".xlsx",
+	"application/rtf": ".rtf",
+	"text/plain":      ".txt",
+}
+
+// Returns the extension a downloaded document should be saved with. A PDF
+// signature always wins; otherwise the Content-Type decides, and generic types
+// such as binary/octet-stream fall back to a known extension in the URL's path
+// and finally to ".pdf".
+func documentExtension(contentType, rawURL string, body *bufio.Reader) string {
+	if hasPDFMagic(body) {
+		return ".pdf"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && !genericContentType(mediaType) { // Generic types say nothing about the format
+		if extension, ok := documentExtensions[mediaType]; ok {
+			return extension
+		}
+		if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+			return extensions[0]
+		}
+	}
+	if parsedURL, err := url.Parse(rawURL); err == nil {
+		if extension := strings.ToLower(path.Ext(parsedURL.Path)); knownExtension(extension) {
+			return extension
+		}
+	}
+	return ".pdf"
+}
+
+// Reports whether contentType is a generic binary type such as
+// binary/octet-stream or application/octet-stream, which says nothing about the format
+func genericContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasSuffix(strings.ToLower(mediaType), "/octet-stream")
+}
+
+// Reports whether extension belongs to one of the document types above
+func knownExtension(extension string) bool {
+	for _, known := range documentExtensions {
+		if extension == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the ".pdf" extension of filePath, also dropping the "_docx"-style tail
+// that URLToFilename leaves when the name already carried the real extension
+// (e.g. "msds_sheet_docx.pdf" with ".docx" → "msds_sheet.docx")
+func withExtension(filePath, extension string) string {
+	current := getFileExtension(filePath)
+	if current == extension {
+		return filePath
+	}
+	base := strings.TrimSuffix(filePath, current)
+	if tail := "_" + strings.TrimPrefix(extension, "."); len(base) > len(tail) && strings.EqualFold(base[len(base)-len(tail):], tail) {
+		base = base[:len(base)-len(tail)] // Whatever the case the name kept
+	}
+	return base + extension
+}
@@ -0,0 +1,348 @@
+package sds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix" // Public suffix list for registrable domain lookup
+)
+
+// FileExists checks if the file exists
+// If the file exists, it returns true
+// If the file does not exist, it returns false
+func FileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+// RemoveFile removes a file from the file system
+func RemoveFile(path string) error {
+	return os.Remove(path)
+}
+
+// DirectoryExists checks whether a given directory exists
+func DirectoryExists(path string) bool {
+	directory, err := os.Stat(path) // Get info for the path
+	if err != nil {
+		return false // Return false if error occurs
+	}
+	return directory.IsDir() // Return true if it's a directory
+}
+
+// CreateDirectory creates a directory, along with any missing parents, at given path
+// with provided permissions. A directory that already exists is not an error.
+func CreateDirectory(path string, permission os.FileMode) error {
+	return os.MkdirAll(path, permission) // Attempt to create directory
+}
+
+// IsURLValid verifies whether a string is a valid URL format
+func IsURLValid(uri string) bool {
+	_, err := url.ParseRequestURI(uri) // Try parsing the URL
+	return err == nil                  // Return true if valid
+}
+
+// Extracts filename from full path (e.g. "/dir/file.pdf" → "file.pdf")
+func getFilename(path string) string {
+	return filepath.Base(path) // Use Base function to get file name only
+}
+
+// Gets the file extension from a given file path
+func getFileExtension(path string) string {
+	return filepath.Ext(path) // Extract and return file extension
+}
+
+// Longest base name URLToFilename produces, leaving room for extensions and numeric suffixes
+const maxFilenameLength = 100
+
+// Device names Windows refuses to use as a file name, whatever the extension
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// Truncates an over-long base name and appends a short hash of rawURL, so
+// different URLs sharing a long prefix still get different names
+func shortenFilename(name, rawURL string) string {
+	if len(name) <= maxFilenameLength {
+		return name
+	}
+	suffix := urlHashSuffix(rawURL)
+	return strings.TrimRight(name[:maxFilenameLength-len(suffix)], "_") + suffix
+}
+
+// Returns a short suffix derived from rawURL (e.g. "_3fa2b1c4") that tells apart
+// different URLs sharing a filename
+func urlHashSuffix(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return "_" + hex.EncodeToString(sum[:4])
+}
+
+// Pages of spheracloud that serve an SDS named by its searchvalue parameter
+var sdsFetchPages = []string{"LoginFetch.aspx", "ViewFetch.aspx"}
+
+// Returns the searchvalue query parameter of a spheracloud LoginFetch.aspx or
+// ViewFetch.aspx URL (e.g. "622613001_US_EN"), or "" for any other URL
+func sdsSearchValue(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	for _, page := range sdsFetchPages {
+		if strings.EqualFold(path.Base(parsedURL.Path), page) {
+			return strings.TrimSpace(parsedURL.Query().Get("searchvalue"))
+		}
+	}
+	return ""
+}
+
+// SDSLanguage returns the language of a spheracloud SDS URL, taken from the last
+// part of its searchvalue (e.g. "EN" for "622613001_US_EN"), or "" when unknown
+func SDSLanguage(rawURL string) string {
+	searchValue := sdsSearchValue(rawURL)
+	separator := strings.LastIndex(searchValue, "_")
+	if separator < 0 {
+		return ""
+	}
+	return strings.ToUpper(searchValue[separator+1:])
+}
+
+// SuffixLanguage returns the language of a document named by its URL path under
+// the citgo convention: "ES" for a Spanish edition, whose name ends in "-s"
+// (e.g. "631310001-s.pdf"), and "EN" otherwise. It returns "" for spheracloud
+// URLs, whose language is in the searchvalue.
+func SuffixLanguage(rawURL string) string {
+	if sdsSearchValue(rawURL) != "" {
+		return ""
+	}
+	_, language := splitLanguageSuffix(strings.TrimSuffix(pathFilename(rawURL), ".pdf"))
+	return strings.ToUpper(language)
+}
+
+// Splits a sanitized name without extension into its product code and language
+// by the "-s" convention (which sanitizing turns into "_s"): "631310001_s" →
+// "631310001", "es" and "631310001" → "631310001", "en"
+func splitLanguageSuffix(name string) (string, string) {
+	if len(name) > 2 && strings.EqualFold(name[len(name)-2:], "_s") {
+		return name[:len(name)-2], "es"
+	}
+	return name, "en"
+}
+
+// Rewrites a sanitized filename taken from a URL path into a language-tagged
+// one like those of spheracloud documents (e.g. "631310001_s.pdf" → "631310001_es.pdf")
+func languageTaggedFilename(filename string) string {
+	code, language := splitLanguageSuffix(strings.TrimSuffix(filename, ".pdf"))
+	return code + "_" + language + ".pdf"
+}
+
+// URLToFilename converts a raw URL into a sanitized lowercase PDF filename safe for filesystem
+func URLToFilename(rawURL string) string {
+	return strings.ToLower(urlFilename(rawURL))
+}
+
+// Does the work of URLToFilename, keeping the case of the URL's letters
+func urlFilename(rawURL string) string {
+	if searchValue := sdsSearchValue(rawURL); searchValue != "" {
+		return sanitizeFilename(searchValue, rawURL) // The product ID beats the shared "loginfetch" name
+	}
+	return pathFilename(rawURL)
+}
+
+// Returns the sanitized last element of a URL or path (e.g. "C10005B.pdf" → "C10005B.pdf")
+func pathFilename(rawURL string) string {
+	return sanitizeFilename(getFilename(rawURL), rawURL) // Extract filename from URL
+}
+
+// Characters sanitizeFilename replaces with underscores
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// What a ".pdf" inside a name turns into once sanitized, removed in any case
+var pdfSuffixPattern = regexp.MustCompile(`(?i)_pdf`)
+
+// Turns name into a PDF filename safe for any filesystem, keeping the case of
+// its letters for Config.FilenameCase to settle; rawURL tells apart names that
+// had to be shortened
+func sanitizeFilename(name, rawURL string) string {
+	safe := nonAlphanumeric.ReplaceAllString(name, "_") // Replace non-alphanumeric with underscores
+
+	safe = regexp.MustCompile(`_+`).ReplaceAllString(safe, "_") // Collapse multiple underscores into one
+	safe = strings.Trim(safe, "_")                              // Trim leading and trailing underscores
+
+	safe = pdfSuffixPattern.ReplaceAllString(safe, "") // Remove the "_pdf" left by the extension, whatever its case
+
+	safe = shortenFilename(safe, rawURL) // Keep names within filesystem limits
+	if windowsReservedNames[strings.ToLower(strings.TrimSuffix(safe, ".pdf"))] {
+		safe = "sds_" + safe // "con.pdf" and friends can't be created on Windows
+	}
+
+	if getFileExtension(safe) != ".pdf" { // Ensure file ends with .pdf
+		safe = safe + ".pdf"
+	}
+
+	return safe // Return sanitized filename
+}
+
+// Adds the suffix hashed from rawURL to a path, before its extension (e.g.
+// "c10139.pdf" → "c10139_3fa2b1c4.pdf"), unless it already has it
+func hashedPath(path, rawURL string) string {
+	extension := getFileExtension(path)
+	base := strings.TrimSuffix(path, extension)
+	if strings.HasSuffix(base, urlHashSuffix(rawURL)) {
+		return path
+	}
+	return base + urlHashSuffix(rawURL) + extension
+}
+
+// Builds the numbered variant of a path (e.g. "c10139.pdf", 1 → "c10139_1.pdf")
+func numberedPath(path string, number int) string {
+	if number == 0 {
+		return path
+	}
+	extension := getFileExtension(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, extension), number, extension)
+}
+
+// Finds where a document should be saved when its preferred path may already
+// hold a different one. It walks "name.pdf", "name_1.pdf", ... and returns the
+// first free path, or the path already holding a file of the same size and
+// SHA-256 with duplicate set.
+func availablePath(path string, size int64, sha256 string) (candidate string, duplicate bool) {
+	for number := 0; ; number++ {
+		candidate = numberedPath(path, number)
+		info, err := os.Stat(candidate)
+		if err != nil {
+			return candidate, false // Free slot for this document
+		}
+		if info.Size() == size {
+			if existing, err := fileSHA256(candidate); err == nil && existing == sha256 {
+				return candidate, true // Same document already saved here
+			}
+		}
+	}
+}
+
+// Writes data to a ".part" file next to path and renames it into place once the
+// write is complete, so an interrupted run never leaves a truncated file at path
+func writeFileAtomically(path string, data []byte) error {
+	tempPath := path + ".part"
+	out, err := os.Create(tempPath) // Create temporary output file
+	if err != nil {
+		return err
+	}
+
+	written, err := out.Write(data) // Write the full content
+	if err == nil && written != len(data) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		err = out.Sync() // Flush to disk before the rename makes it visible
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path) // Atomically move into place
+	}
+	if err != nil {
+		if removeErr := RemoveFile(tempPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			slog.Warn("Failed to remove partial file", "path", tempPath, "error", removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// ExtractBaseDomain takes a URL string and returns only the bare domain name
+// without any subdomains or suffixes (e.g., ".com", ".org", ".co.uk").
+func ExtractBaseDomain(inputUrl string) string {
+	// Parse the input string into a structured URL object
+	parsedUrl, parseError := url.Parse(inputUrl)
+
+	// If parsing fails, log the error and return an empty string
+	if parseError != nil {
+		slog.Warn("Error parsing URL", "url", inputUrl, "error", parseError)
+		return ""
+	}
+
+	// Extract the hostname (e.g., "sub.example.com")
+	hostName := parsedUrl.Hostname()
+
+	// IP addresses have no domain structure, so return them as-is
+	if net.ParseIP(hostName) != nil {
+		return hostName
+	}
+
+	// Use the public suffix list to find the registrable domain, so multi-part
+	// suffixes are handled correctly
+	// Example: "sub.example.com" -> "example.com"
+	//          "blog.my-site.co.uk" -> "my-site.co.uk"
+	registrableDomain, err := publicsuffix.EffectiveTLDPlusOne(hostName)
+
+	// Hosts without a registrable domain (e.g. "localhost") are returned as-is
+	if err != nil {
+		return hostName
+	}
+
+	// Strip the public suffix to leave the bare label
+	// Example: "my-site.co.uk" -> "my-site"
+	suffix, _ := publicsuffix.PublicSuffix(registrableDomain)
+	return strings.TrimSuffix(registrableDomain, "."+suffix)
+}
+
+// ErrLowDiskSpace is returned when a write would leave less than Config.MinFreeSpace free
+var ErrLowDiskSpace = errors.New("not enough free disk space")
+
+// CheckFreeSpace returns ErrLowDiskSpace if writing need more bytes into directory
+// would leave less than Config.MinFreeSpace free. Platforms without a free space
+// query are never reported as full.
+func (downloader *Downloader) CheckFreeSpace(directory string, need uint64) error {
+	if downloader.MinFreeSpace == 0 {
+		return nil
+	}
+	free, err := FreeSpace(directory)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("check free space: %w", err)
+	}
+	if free < need || free-need < downloader.MinFreeSpace {
+		return fmt.Errorf("%w in %s: %s free, %s required", ErrLowDiskSpace, directory,
+			formatSize(free), formatSize(downloader.MinFreeSpace+need))
+	}
+	return nil
+}
+
+// Formats a byte count in MiB for error messages
+func formatSize(bytes uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(bytes)/(1<<20))
+}
+
+// Returns the hex SHA-256 of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
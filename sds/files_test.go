@@ -0,0 +1,100 @@
+package sds
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagLanguages(t *testing.T) {
+	tests := []struct {
+		url      string
+		filename string // Saved name with Config.TagLanguages
+		language string // SuffixLanguage
+	}{
+		{"http://www.docs.citgo.com/msds_pi/631310001-s.pdf", "631310001_es.pdf", "ES"},
+		{"http://www.docs.citgo.com/msds_pi/631310001.pdf", "631310001_en.pdf", "EN"},
+		{"http://www.docs.citgo.com/msds_pi/631310001_S.pdf", "631310001_es.pdf", "ES"},
+		{"https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001_MX_ES", "622613001_mx_es.pdf", ""}, // Already tagged
+	}
+	downloader := newTestDownloader(t, nil, Config{TagLanguages: true})
+	for _, test := range tests {
+		if got := filepath.Base(downloader.OutputPath(test.url)); got != test.filename {
+			t.Errorf("OutputPath(%s) = %s, want %s", test.url, got, test.filename)
+		}
+		if got := SuffixLanguage(test.url); got != test.language {
+			t.Errorf("SuffixLanguage(%s) = %q, want %q", test.url, got, test.language)
+		}
+	}
+}
+
+func TestExtractBaseDomain(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://sub.example.com/sds.pdf", "example"},
+		{"https://example.co.uk/sds.pdf", "example"},
+		{"https://a.b.example.com.au/sds.pdf", "example"},
+		{"http://localhost:8080/sds.pdf", "localhost"},
+		{"http://192.168.1.10/sds.pdf", "192.168.1.10"},
+	}
+	for _, test := range tests {
+		if got := ExtractBaseDomain(test.url); got != test.want {
+			t.Errorf("ExtractBaseDomain(%s) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+func TestURLToFilename(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://apps.spheracloud.net/LoginFetch.aspx?method=FETCHSDS&searchfield=SN&searchvalue=622613001_US_EN", "622613001_us_en.pdf"},
+		{"https://apps.spheracloud.net/ViewFetch.aspx?method=FETCHSDS&searchfield=SN&searchvalue=622613001_US_EN", "622613001_us_en.pdf"},
+		{"https://apps.spheracloud.net/viewfetch.aspx?searchvalue=631310001_MX_ES", "631310001_mx_es.pdf"},
+		{"http://www.docs.citgo.com/msds_pi/C10005B.pdf", "c10005b.pdf"},
+		{"https://apps.spheracloud.net/Other.aspx?searchvalue=622613001_US_EN", "other_aspx_searchvalue_622613001_us_en.pdf"}, // Not a page named by searchvalue
+	}
+	for _, test := range tests {
+		if got := URLToFilename(test.url); got != test.want {
+			t.Errorf("URLToFilename(%s) = %s, want %s", test.url, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"C10005B.pdf", "C10005B.pdf"},
+		{"con", "sds_con.pdf"},
+		{"CON.pdf", "sds_CON.pdf"},
+		{"lpt1.pdf", "sds_lpt1.pdf"},
+		{"console.pdf", "console.pdf"}, // Only the exact device names are reserved
+	}
+	for _, test := range tests {
+		if got := sanitizeFilename(test.name, "http://www.docs.citgo.com/msds_pi/"+test.name); got != test.want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeFilenameShortens(t *testing.T) {
+	long := strings.Repeat("622613001_US_EN_", 20)
+	first := "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=" + long + "A"
+	second := "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=" + long + "B"
+
+	name := URLToFilename(first)
+	if len(name) != maxFilenameLength+len(".pdf") {
+		t.Errorf("URLToFilename gave %d characters (%s), want %d", len(name), name, maxFilenameLength+len(".pdf"))
+	}
+	if !strings.HasSuffix(name, urlHashSuffix(first)+".pdf") || !strings.HasPrefix(name, "622613001_us_en_") {
+		t.Errorf("URLToFilename = %s, want the start of the searchvalue and a hash of the URL", name)
+	}
+	if other := URLToFilename(second); other == name {
+		t.Errorf("URLs differing past the cut share the name %s", name)
+	}
+}
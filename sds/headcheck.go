@@ -0,0 +1,57 @@
+package sds
+
+import (
+	"context"
+	"net/http"
+)
+
+// HeadResult describes the response to a HeadCheck
+type HeadResult struct {
+	URL           string // URL that was checked
+	FinalURL      string // URL that answered, after any HTTP redirects
+	Method        string // HEAD, or GET for servers that refuse HEAD
+	StatusCode    int    // Numeric status, e.g. 200
+	Status        string // Status line, e.g. "200 OK"
+	ContentType   string // Declared Content-Type ("" if none)
+	ContentLength int64  // Declared size in bytes (-1 if unknown)
+}
+
+// Redirected reports whether the server sent the request on to another URL
+func (result HeadResult) Redirected() bool {
+	return result.FinalURL != result.URL
+}
+
+// HeadCheck asks the server about finalURL without downloading it: a HEAD
+// request, or for servers that refuse HEAD a GET whose body is closed unread.
+// Any status is a result; only a failed request returns an error.
+func (downloader *Downloader) HeadCheck(ctx context.Context, finalURL string) (HeadResult, error) {
+	result, err := downloader.headCheck(ctx, "HEAD", finalURL)
+	if err == nil && (result.StatusCode == http.StatusMethodNotAllowed || result.StatusCode == http.StatusNotImplemented) {
+		result, err = downloader.headCheck(ctx, "GET", finalURL)
+	}
+	return result, classify(finalURL, err, KindNetwork)
+}
+
+// Sends one request of HeadCheck and reads the answer's headers
+func (downloader *Downloader) headCheck(ctx context.Context, method, finalURL string) (HeadResult, error) {
+	result := HeadResult{URL: finalURL, FinalURL: finalURL, Method: method, ContentLength: -1}
+	release, err := downloader.startRequest(ctx, finalURL)
+	if err != nil {
+		return result, err
+	}
+	defer release()
+	req, err := downloader.newRequest(ctx, method, finalURL)
+	if err != nil {
+		return result, err
+	}
+	resp, err := downloader.HTTPClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	resp.Body.Close() // Only the headers matter; closing early aborts a GET's transfer
+	result.FinalURL = resp.Request.URL.String()
+	result.StatusCode, result.Status = resp.StatusCode, resp.Status
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.ContentLength = resp.ContentLength
+	return result, nil
+}
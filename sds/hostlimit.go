@@ -0,0 +1,76 @@
+package sds
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate" // Ticker shared by all request starts
+)
+
+// Caps the number of simultaneous requests to each host, independently of how
+// many workers are running, so a list dominated by one site stays polite to it
+type hostLimiter struct {
+	mu    sync.Mutex               // Guards slots
+	limit int                      // Requests allowed per host at once (0 means unlimited)
+	slots map[string]chan struct{} // Host → semaphore holding one token per running request
+}
+
+// Creates a limiter allowing limit requests per host at once
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// Waits for a free slot on the host of rawURL and returns the function that
+// frees it again, or ctx's error if ctx ends first
+func (limiter *hostLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	if limiter.limit <= 0 {
+		return func() {}, nil
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return func() {}, nil // The request itself will report the bad URL
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+
+	limiter.mu.Lock()
+	slot, ok := limiter.slots[host]
+	if !ok {
+		slot = make(chan struct{}, limiter.limit)
+		limiter.slots[host] = slot
+	}
+	limiter.mu.Unlock()
+
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Creates the limiter spacing out request starts for Config.GlobalInterval, or nil for none
+func newRequestPacer(interval time.Duration) *rate.Limiter {
+	if interval <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Every(interval), 1) // A burst of one keeps every pair of starts apart
+}
+
+// Waits for a free slot on the host of rawURL, then for Config.GlobalInterval
+// to pass since the last request to any host, and returns the function that
+// frees the slot. The slot is held during the second wait, so a request that
+// has been paced is sure to start.
+func (downloader *Downloader) startRequest(ctx context.Context, rawURL string) (func(), error) {
+	release, err := downloader.hosts.acquire(ctx, rawURL)
+	if err != nil || downloader.pacer == nil {
+		return release, err
+	}
+	if err := downloader.pacer.Wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
@@ -0,0 +1,164 @@
+package sds
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManifestEntry is one saved file listed in a manifest
+type ManifestEntry struct {
+	Path       string    // File path relative to the output directory, with forward slashes
+	URL        string    // URL the file was downloaded from
+	Size       int64     // Number of bytes saved
+	SHA256     string    // Hex SHA-256 of the saved file ("" if never recorded)
+	Downloaded time.Time // When the file was saved
+}
+
+// Columns of a manifest, in order; an appended manifest adds the time of the
+// run that wrote each row as a "run" column
+var manifestHeader = []string{"path", "url", "size", "sha256", "downloaded"}
+
+// ErrMismatch reports a saved file whose size or checksum differs from its manifest entry
+var ErrMismatch = errors.New("file differs from manifest")
+
+// WriteManifest writes a CSV manifest of every file saved in OutputDir, this
+// run or earlier, with paths relative to OutputDir
+func (downloader *Downloader) WriteManifest(path string) error {
+	return downloader.metadata.writeManifest(path)
+}
+
+// AppendManifest adds a row for every file saved since runStart to the manifest
+// at path, creating it if needed, so repeated runs build up a history of when
+// each document was fetched. Each row's "run" column holds runStart.
+func (downloader *Downloader) AppendManifest(path string, runStart time.Time) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	header, err := csv.NewReader(file).Read()
+	switch {
+	case errors.Is(err, io.EOF): // New file, so it needs its header
+		if _, err := file.WriteString(strings.Join(manifestHeader, ",") + ",run\n"); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("%s: %w", path, err)
+	case len(header) != len(manifestHeader)+1 || header[len(header)-1] != "run":
+		return fmt.Errorf("%s: not an appended manifest (no run column)", path)
+	}
+
+	var buf bytes.Buffer
+	run := runStart.UTC().Format(time.RFC3339)
+	savedThisRun := func(entry fileMetadata) bool { return !entry.Downloaded.Before(runStart) }
+	if err := downloader.metadata.writeManifestRows(&buf, savedThisRun, run); err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Writes a manifest row for every recorded file, sorted by path
+func (store *metadataStore) writeManifest(path string) error {
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(manifestHeader, ",") + "\n")
+	if err := store.writeManifestRows(&buf, nil); err != nil {
+		return err
+	}
+	return writeFileAtomically(path, buf.Bytes())
+}
+
+// Writes the CSV rows of the recorded files that keep accepts (all if nil),
+// sorted by path, each followed by the extra columns
+func (store *metadataStore) writeManifestRows(out io.Writer, keep func(fileMetadata) bool, extra ...string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+	names := make([]string, 0, len(store.entries))
+	for name, entry := range store.entries {
+		if keep == nil || keep(entry) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names) // Stable output keeps diffs between runs small
+
+	writer := csv.NewWriter(out)
+	for _, name := range names {
+		entry := store.entries[name]
+		row := []string{name, entry.URL, strconv.FormatInt(entry.Size, 10), entry.SHA256, entry.Downloaded.Format(time.RFC3339)}
+		writer.Write(append(row, extra...))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadManifest reads a manifest written by WriteManifest or AppendManifest.
+// When a path has several rows, as in an appended manifest, the last one wins.
+func ReadManifest(path string) ([]ManifestEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll() // Every row as wide as the header
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(records) == 0 || len(records[0]) < len(manifestHeader) || records[0][0] != manifestHeader[0] {
+		return nil, fmt.Errorf("%s: not a manifest (missing header)", path)
+	}
+
+	entries := make([]ManifestEntry, 0, len(records)-1)
+	index := make(map[string]int) // Path → position in entries
+	for line, record := range records[1:] {
+		size, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid size %q", path, line+2, record[2])
+		}
+		downloaded, _ := time.Parse(time.RFC3339, record[4]) // Informational only
+		entry := ManifestEntry{Path: record[0], URL: record[1], Size: size, SHA256: record[3], Downloaded: downloaded}
+		if position, seen := index[entry.Path]; seen {
+			entries[position] = entry // A later run fetched it again
+			continue
+		}
+		index[entry.Path] = len(entries)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// CheckManifestEntry compares the file an entry describes, inside dir, with the
+// entry. It returns an error wrapping os.ErrNotExist when the file is gone and
+// ErrMismatch when its size differs or, with checkHash, its SHA-256 does.
+func CheckManifestEntry(dir string, entry ManifestEntry, checkHash bool) error {
+	filePath := filepath.Join(dir, filepath.FromSlash(entry.Path))
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() != entry.Size {
+		return fmt.Errorf("%w: %d bytes, manifest says %d", ErrMismatch, info.Size(), entry.Size)
+	}
+	if !checkHash || entry.SHA256 == "" {
+		return nil
+	}
+	sha256, err := fileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	if sha256 != entry.SHA256 {
+		return fmt.Errorf("%w: SHA-256 %s, manifest says %s", ErrMismatch, sha256, entry.SHA256)
+	}
+	return nil
+}
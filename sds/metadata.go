@@ -0,0 +1,270 @@
+package sds
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the file inside OutputDir holding the validators of each saved PDF
+const metadataFilename = ".sds-metadata.json"
+
+// How often the metadata and resolve cache files are rewritten while records
+// come in; the rest is saved when the Downloader is closed
+const saveInterval = 30 * time.Second
+
+// Server validators recorded for a saved PDF, used by refresh mode to tell
+// whether the remote document changed since it was downloaded
+type fileMetadata struct {
+	URL          string    `json:"url"`                     // URL the file was downloaded from
+	Size         int64     `json:"size"`                    // Number of bytes saved
+	ETag         string    `json:"etag,omitempty"`          // ETag response header
+	LastModified string    `json:"last_modified,omitempty"` // Last-Modified response header
+	SHA256       string    `json:"sha256,omitempty"`        // Hex SHA-256 of the saved file
+	Downloaded   time.Time `json:"downloaded"`              // When the file was saved
+}
+
+// Persistent map of output paths (relative to OutputDir) to their metadata
+type metadataStore struct {
+	mu      sync.Mutex              // Guards entries and the file on disk
+	path    string                  // Location of the JSON file
+	loaded  bool                    // Whether entries were read from disk yet
+	entries map[string]fileMetadata // Relative output path → metadata
+	dirty   bool                    // Whether entries changed since the last save
+	saved   time.Time               // When entries were last written
+}
+
+// Creates a store backed by the metadata file in outputDir; it is read on first use
+func newMetadataStore(outputDir string) *metadataStore {
+	return &metadataStore{path: filepath.Join(outputDir, metadataFilename), saved: time.Now()}
+}
+
+// Reads the store from disk once; must be called with mu held
+func (store *metadataStore) load() {
+	if store.loaded {
+		return
+	}
+	store.loaded = true
+	store.entries = make(map[string]fileMetadata)
+	if err := readJSONFile(store.path, &store.entries); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Ignoring unreadable metadata file", "path", store.path, "error", err)
+		store.entries = make(map[string]fileMetadata)
+	}
+}
+
+// Returns the key for a file, relative to the directory holding the store
+func (store *metadataStore) key(filePath string) string {
+	relative, err := filepath.Rel(filepath.Dir(store.path), filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(relative)
+}
+
+// Records the validators of a freshly saved file
+func (store *metadataStore) record(filePath, sourceURL string, header http.Header, size int64, sha256 string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+	store.entries[store.key(filePath)] = fileMetadata{
+		URL:          sourceURL,
+		Size:         size,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		SHA256:       sha256,
+		Downloaded:   time.Now().UTC(),
+	}
+	store.changed()
+}
+
+// Records a file already saved for sourceURL that has no record yet, such as
+// one downloaded before the metadata existed, so manifests list it. Without
+// its validators, refresh mode compares its size as for any unrecorded file.
+func (store *metadataStore) adopt(filePath, sourceURL string) {
+	store.mu.Lock()
+	store.load()
+	_, recorded := store.entries[store.key(filePath)]
+	store.mu.Unlock()
+	if recorded {
+		return
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return
+	}
+	sha256, err := fileSHA256(filePath) // Outside the lock, as other downloads record meanwhile
+	if err != nil {
+		slog.Warn("Failed to checksum existing file", "path", filePath, "error", err)
+		return
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, recorded := store.entries[store.key(filePath)]; recorded {
+		return
+	}
+	store.entries[store.key(filePath)] = fileMetadata{
+		URL:        sourceURL,
+		Size:       info.Size(),
+		SHA256:     sha256,
+		Downloaded: info.ModTime().UTC(),
+	}
+	store.changed()
+}
+
+// Marks entries as changed and saves them if the last save is older than
+// saveInterval, so a crash loses little; must be called with mu held
+func (store *metadataStore) changed() {
+	store.dirty = true
+	if time.Since(store.saved) >= saveInterval {
+		store.save()
+	}
+}
+
+// Writes entries to disk; must be called with mu held
+func (store *metadataStore) save() {
+	store.dirty, store.saved = false, time.Now()
+	if err := writeJSONFile(store.path, store.entries); err != nil {
+		slog.Warn("Failed to save metadata file", "path", store.path, "error", err)
+	}
+}
+
+// Writes any entries recorded since the last save
+func (store *metadataStore) flush() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.dirty {
+		store.save()
+	}
+}
+
+// RecordedFiles returns the paths, relative to outputDir with forward slashes,
+// of the files the download metadata in outputDir has a record of
+func RecordedFiles(outputDir string) (map[string]bool, error) {
+	var entries map[string]fileMetadata
+	if err := readJSONFile(filepath.Join(outputDir, metadataFilename), &entries); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	recorded := make(map[string]bool, len(entries))
+	for name := range entries {
+		recorded[name] = true
+	}
+	return recorded, nil
+}
+
+// Reports whether the local file at filePath still matches the remote document
+// described by resp. ETag is compared first, then Last-Modified, and finally the
+// Content-Length against the local size when the server sends no validators.
+func (store *metadataStore) unchanged(filePath string, resp *http.Response) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength != info.Size() {
+		return false // Size differs, so the document certainly changed
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+	recorded, ok := store.entries[store.key(filePath)]
+	if !ok || recorded.Size != info.Size() {
+		return resp.ContentLength >= 0 // Without a usable record, fall back to the size match
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" && recorded.ETag != "" {
+		return etag == recorded.ETag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" && recorded.LastModified != "" {
+		return lastModified == recorded.LastModified
+	}
+	return resp.ContentLength >= 0
+}
+
+// Returns the URL recorded as the source of filePath, or "" if there is none.
+// A path recorded in another case counts too, as it names the same file on
+// case-insensitive filesystems.
+func (store *metadataStore) source(filePath string) string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+	key := store.key(filePath)
+	if entry, ok := store.entries[key]; ok {
+		return entry.URL
+	}
+	for name, entry := range store.entries {
+		if strings.EqualFold(name, key) {
+			return entry.URL
+		}
+	}
+	return ""
+}
+
+// Returns the path of the file recorded as downloaded from rawURL, or "" if there is none
+func (store *metadataStore) pathFor(rawURL string) string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+	for name, entry := range store.entries {
+		if entry.URL == rawURL {
+			return filepath.Join(filepath.Dir(store.path), filepath.FromSlash(name))
+		}
+	}
+	return ""
+}
+
+// Returns the SHA-256 recorded for filePath, or "" if there is none
+func (store *metadataStore) digest(filePath string) string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+	return store.entries[store.key(filePath)].SHA256
+}
+
+// Writes a checksum line ("<hash>  <name>", as produced by sha256sum) for every
+// recorded file, with names relative to the directory holding the store
+func (store *metadataStore) writeChecksums(path string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.load()
+	names := make([]string, 0, len(store.entries))
+	for name, entry := range store.entries {
+		if entry.SHA256 != "" { // Files saved before checksums were recorded have none
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names) // Stable output keeps diffs between runs small
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", store.entries[name].SHA256, name)
+	}
+	return writeFileAtomically(path, buf.Bytes())
+}
+
+// Decodes a JSON file into value
+func readJSONFile(path string, value any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Encodes value as indented JSON and atomically replaces the file at path
+func writeJSONFile(path string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, append(data, '\n'))
+}
@@ -0,0 +1,63 @@
+package sds
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Returns finalURL with its host swapped for the one Config.MirrorHosts maps it
+// to, keeping the scheme, path and query, and whether there is such a mirror
+func (downloader *Downloader) mirrorURL(finalURL string) (string, bool) {
+	parsedURL, err := url.Parse(finalURL)
+	if err != nil || len(downloader.MirrorHosts) == 0 {
+		return "", false
+	}
+	mirrorHost, ok := downloader.MirrorHosts[strings.ToLower(parsedURL.Hostname())]
+	if !ok || mirrorHost == "" {
+		return "", false
+	}
+	mirrored := *parsedURL
+	mirrored.Host = mirrorHost
+	return mirrored.String(), true
+}
+
+// Reports whether a failed download may succeed from a mirror: one the server
+// caused, such as a network failure, an error status or an error page, but not
+// one of the run, the output or a document the mirror would reject as well
+func mirrorable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch kindOf(err, KindNetwork) {
+	case KindNetwork, KindTimeout, KindHTTPStatus, KindContentType, KindNotPDF, KindEmpty:
+		return true
+	}
+	return false
+}
+
+// Tries the mirror copy of finalURL once after primaryErr. The document keeps
+// the name and records of finalURL, so later runs treat it as downloaded from
+// there. If the mirror fails too, primaryErr is returned.
+func (downloader *Downloader) downloadFromMirror(ctx context.Context, finalURL, mirrorURL string, primaryErr error) (Result, error) {
+	slog.Warn("Download failed; trying mirror host", "url", finalURL, "mirror", mirrorURL, "error", primaryErr)
+	result := Result{URL: finalURL, Path: downloader.resolveOutputPath(finalURL), Status: StatusFailed}
+	if !downloader.Allowed(ctx, mirrorURL) { // Be as polite to the mirror as to the primary
+		slog.Warn("Mirror disallowed by robots.txt", "url", finalURL, "mirror", mirrorURL)
+		return result, primaryErr
+	}
+	release, err := downloader.startRequest(ctx, mirrorURL)
+	if err != nil {
+		return result, primaryErr
+	}
+	discardPartial(result.Path + ".part") // The primary's bytes may not match the mirror's copy
+	result, err = downloader.download(ctx, finalURL, mirrorURL)
+	release()
+	if err != nil {
+		slog.Warn("Mirror download failed", "url", finalURL, "mirror", mirrorURL, "error", err)
+		return result, primaryErr
+	}
+	slog.Info("Downloaded from mirror host", "url", finalURL, "mirror", mirrorURL, "path", result.Path)
+	return result, nil
+}
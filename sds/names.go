@@ -0,0 +1,107 @@
+package sds
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// FilenameCase is the letter case output filenames are saved in
+type FilenameCase string
+
+const (
+	CaseLower    FilenameCase = "lower"    // "c10005b.pdf"
+	CaseUpper    FilenameCase = "upper"    // "C10005B.pdf"; the extension stays lowercase
+	CasePreserve FilenameCase = "preserve" // As spelled in the URL or header, e.g. "C10005b.pdf"
+)
+
+// ParseFilenameCase checks a filename case given on the command line
+func ParseFilenameCase(name string) (FilenameCase, error) {
+	switch filenameCase := FilenameCase(name); filenameCase {
+	case CaseLower, CaseUpper, CasePreserve:
+		return filenameCase, nil
+	}
+	return "", fmt.Errorf("unknown filename case %q (want %q, %q or %q)", name, CaseLower, CaseUpper, CasePreserve)
+}
+
+// Returns name in the case, leaving the extension of a filename lowercase
+func (filenameCase FilenameCase) apply(name string) string {
+	switch filenameCase {
+	case CasePreserve:
+		return name
+	case CaseUpper:
+		extension := path.Ext(name)
+		return strings.ToUpper(strings.TrimSuffix(name, extension)) + strings.ToLower(extension)
+	}
+	return strings.ToLower(name) // CaseLower, the default
+}
+
+// NameFields are the values available to a -name-template, in the case of
+// Config.FilenameCase
+type NameFields struct {
+	Name       string // Default sanitized name without extension (e.g. "c10005b" or "622613001_us_en")
+	Code       string // Product code (e.g. "c10005b", or "622613001" from a spheracloud searchvalue)
+	Lang       string // Region and language from a spheracloud searchvalue (e.g. "us_en"), else ""
+	Host       string // Host of the URL (e.g. "www.docs.citgo.com")
+	BaseDomain string // Registrable domain without its suffix (e.g. "citgo")
+	Ext        string // File extension without the dot, always "pdf"
+}
+
+// Returns the template fields for a URL, in the case of its letters
+func nameFieldsFor(rawURL string) NameFields {
+	name := strings.TrimSuffix(urlFilename(rawURL), ".pdf")
+	fields := NameFields{Name: name, Code: name, Ext: "pdf"}
+	if parsedURL, err := url.Parse(rawURL); err == nil {
+		fields.Host = parsedURL.Hostname()
+		fields.BaseDomain = ExtractBaseDomain(rawURL)
+	}
+	if searchValue := sdsSearchValue(rawURL); searchValue != "" {
+		// spheracloud searchvalues look like "622613001_US_EN": code, then region and language
+		fields.Code, fields.Lang, _ = strings.Cut(searchValue, "_")
+	}
+	return fields
+}
+
+// ParseNameTemplate parses a text/template for output filenames, such as
+// "{{.BaseDomain}}-{{.Code}}.{{.Ext}}", and checks it renders for a sample URL
+// so mistakes like unknown fields are reported before any work starts
+func ParseNameTemplate(text string) (*template.Template, error) {
+	nameTemplate, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	sample := "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001_US_EN"
+	if _, err := renderName(nameTemplate, nameFieldsFor(sample), sample); err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	return nameTemplate, nil
+}
+
+// Characters allowed in a rendered name; everything else becomes an underscore
+var unsafeNameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Renders the filename for rawURL from its fields and makes it safe for the
+// filesystem, keeping the case of its letters for Config.FilenameCase to settle
+func renderName(nameTemplate *template.Template, fields NameFields, rawURL string) (string, error) {
+	var buf bytes.Buffer
+	if err := nameTemplate.Execute(&buf, fields); err != nil {
+		return "", err
+	}
+	name := unsafeNameCharacters.ReplaceAllString(buf.String(), "_")
+	if strings.EqualFold(path.Ext(name), ".pdf") {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	name = strings.Trim(name, "._-") // No hidden files or dangling separators (e.g. an empty {{.Lang}})
+	if name == "" {
+		return "", fmt.Errorf("template rendered an empty name for %s", rawURL)
+	}
+	name = shortenFilename(name, rawURL) // Keep names within filesystem limits
+	if windowsReservedNames[strings.ToLower(name)] {
+		name = "sds_" + name
+	}
+	return name + ".pdf", nil
+}
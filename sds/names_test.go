@@ -0,0 +1,111 @@
+package sds
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFilenameCase(t *testing.T) {
+	const (
+		citgoURL  = "http://www.docs.citgo.com/msds_pi/C10005B.pdf"
+		mixedURL  = "http://www.docs.citgo.com/msds_pi/C10005b.pdf"
+		sphereURL = "https://apps.spheracloud.net/LoginFetch.aspx?method=FETCHSDS&searchfield=SN&searchvalue=622613001_US_EN"
+	)
+	tests := []struct {
+		url      string
+		template string // -name-template ("" for the default names)
+		want     map[FilenameCase]string
+	}{
+		{citgoURL, "", map[FilenameCase]string{
+			CaseLower: "c10005b.pdf", CaseUpper: "C10005B.pdf", CasePreserve: "C10005B.pdf",
+		}},
+		{mixedURL, "", map[FilenameCase]string{
+			CaseLower: "c10005b.pdf", CaseUpper: "C10005B.pdf", CasePreserve: "C10005b.pdf",
+		}},
+		{sphereURL, "", map[FilenameCase]string{
+			CaseLower: "622613001_us_en.pdf", CaseUpper: "622613001_US_EN.pdf", CasePreserve: "622613001_US_EN.pdf",
+		}},
+		{sphereURL, "{{.BaseDomain}}-{{.Code}}-{{.Lang}}", map[FilenameCase]string{
+			CaseLower: "spheracloud-622613001-us_en.pdf", CaseUpper: "SPHERACLOUD-622613001-US_EN.pdf", CasePreserve: "spheracloud-622613001-US_EN.pdf",
+		}},
+		{citgoURL, "{{.Code}}", map[FilenameCase]string{
+			CaseLower: "c10005b.pdf", CaseUpper: "C10005B.pdf", CasePreserve: "C10005B.pdf",
+		}},
+	}
+	for _, test := range tests {
+		for filenameCase, want := range test.want {
+			t.Run(string(filenameCase)+" "+want, func(t *testing.T) {
+				config := Config{FilenameCase: filenameCase}
+				if test.template != "" {
+					nameTemplate, err := ParseNameTemplate(test.template)
+					if err != nil {
+						t.Fatal(err)
+					}
+					config.NameTemplate = nameTemplate
+				}
+				downloader := newTestDownloader(t, nil, config)
+				if got := filepath.Base(downloader.OutputPath(test.url)); got != want {
+					t.Errorf("OutputPath(%s) = %s, want %s", test.url, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestOutputRegistryIgnoresCase(t *testing.T) {
+	registry := &outputRegistry{owners: make(map[string]string)}
+	registry.claim(filepath.Join("PDFs", "C10005B.pdf"), "http://a.example/C10005B.pdf")
+	owner, ok := registry.ownerOf(filepath.Join("PDFs", "c10005b.pdf"))
+	if !ok || owner != "http://a.example/C10005B.pdf" {
+		t.Errorf("ownerOf(c10005b.pdf) = %q, %v; want the claim of C10005B.pdf", owner, ok)
+	}
+
+	// So a second URL whose name differs only in case gets a hashed name
+	downloader := newTestDownloader(t, nil, Config{FilenameCase: CasePreserve})
+	first := downloader.claimOutputPath("http://a.example/C10005B.pdf")
+	second := downloader.OutputPath("http://b.example/c10005b.pdf")
+	if filepath.Base(first) != "C10005B.pdf" || filepath.Base(second) == "c10005b.pdf" {
+		t.Errorf("paths = %s and %s, want the second one hashed", first, second)
+	}
+}
+
+func TestRenderName(t *testing.T) {
+	const (
+		citgoURL  = "http://www.docs.citgo.com/msds_pi/C10005B.pdf"
+		sphereURL = "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001_US_EN"
+	)
+	tests := []struct {
+		template string
+		url      string
+		want     string // "" when rendering fails
+	}{
+		{"{{.BaseDomain}}-{{.Code}}.{{.Ext}}", citgoURL, "citgo-C10005B.pdf"},
+		{"{{.Code}}_{{.Lang}}", sphereURL, "622613001_US_EN.pdf"},
+		{"{{.Code}}_{{.Lang}}", citgoURL, "C10005B.pdf"}, // The empty language leaves no dangling "_"
+		{"{{.Host}}/{{.Name}}", citgoURL, "www.docs.citgo.com_C10005B.pdf"},
+		{"con", citgoURL, "sds_con.pdf"},
+		{"{{.Lang}}", citgoURL, ""},
+	}
+	for _, test := range tests {
+		nameTemplate, err := ParseNameTemplate(test.template)
+		if err != nil {
+			t.Fatalf("ParseNameTemplate(%q): %v", test.template, err)
+		}
+		got, err := renderName(nameTemplate, nameFieldsFor(test.url), test.url)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q for %s = %q, want an error", test.template, test.url, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%q for %s = %q (error %v), want %q", test.template, test.url, got, err, test.want)
+		}
+	}
+
+	for _, text := range []string{"{{.Code", "{{.Product}}"} {
+		if _, err := ParseNameTemplate(text); err == nil {
+			t.Errorf("ParseNameTemplate(%q) accepted a broken template", text)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package sds
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NameSource is a place an output filename can be taken from
+type NameSource string
+
+const (
+	NameFromHeader NameSource = "header" // The response's Content-Disposition filename
+	NameFromQuery  NameSource = "query"  // A spheracloud searchvalue (e.g. "622613001_us_en.pdf")
+	NameFromURL    NameSource = "url"    // The last element of the URL, including any query (e.g. "c10005b.pdf")
+)
+
+// DefaultNameSources is the order names are looked for when Config.NameSources is empty
+var DefaultNameSources = []NameSource{NameFromHeader, NameFromQuery, NameFromURL}
+
+// Returns a sanitized filename from one source, or "" when that source has none.
+// The header is nil before the response arrives.
+type nameExtractor func(finalURL string, header http.Header) string
+
+// Extractor for every NameSource; new sources only need an entry here
+var nameExtractors = map[NameSource]nameExtractor{
+	NameFromHeader: func(_ string, header http.Header) string {
+		return contentDispositionFilename(header)
+	},
+	NameFromQuery: func(finalURL string, _ http.Header) string {
+		if searchValue := sdsSearchValue(finalURL); searchValue != "" {
+			return sanitizeFilename(searchValue, finalURL)
+		}
+		return ""
+	},
+	NameFromURL: func(finalURL string, _ http.Header) string {
+		return pathFilename(finalURL)
+	},
+}
+
+// ParseNameSources checks a list of source names such as "header,query,url"
+func ParseNameSources(names []string) ([]NameSource, error) {
+	sources := make([]NameSource, 0, len(names))
+	for _, name := range names {
+		source := NameSource(strings.ToLower(name))
+		if _, ok := nameExtractors[source]; !ok {
+			return nil, fmt.Errorf("unknown filename source %q (want %q, %q or %q)", name, NameFromHeader, NameFromQuery, NameFromURL)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// Returns the filename from the first of Config.NameSources that has one,
+// falling back to URLToFilename. With Config.TagLanguages, a name taken from
+// the URL path gets a language tag.
+func (downloader *Downloader) filenameFor(finalURL string, header http.Header) string {
+	sources := downloader.NameSources
+	if len(sources) == 0 {
+		sources = DefaultNameSources
+	}
+	for _, source := range sources {
+		if name := nameExtractors[source](finalURL, header); name != "" {
+			if source == NameFromURL && downloader.TagLanguages {
+				name = languageTaggedFilename(name)
+			}
+			return name
+		}
+	}
+	if downloader.TagLanguages && sdsSearchValue(finalURL) == "" {
+		return languageTaggedFilename(pathFilename(finalURL))
+	}
+	return URLToFilename(finalURL)
+}
@@ -0,0 +1,43 @@
+package sds
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFilenameForSources(t *testing.T) {
+	const (
+		citgoURL  = "http://www.docs.citgo.com/msds_pi/C10005B.pdf"
+		sphereURL = "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001_US_EN"
+	)
+	disposition := http.Header{"Content-Disposition": {`attachment; filename="Product Sheet.pdf"`}}
+	tests := []struct {
+		sources []string // Config.NameSources (the default order if nil)
+		url     string
+		header  http.Header
+		want    string
+	}{
+		{nil, sphereURL, disposition, "Product_Sheet.pdf"},
+		{nil, sphereURL, nil, "622613001_US_EN.pdf"},
+		{nil, citgoURL, disposition, "Product_Sheet.pdf"},
+		{nil, citgoURL, nil, "C10005B.pdf"},
+		{[]string{"query", "header", "url"}, sphereURL, disposition, "622613001_US_EN.pdf"},
+		{[]string{"query", "header", "url"}, citgoURL, disposition, "Product_Sheet.pdf"},
+		{[]string{"url", "header"}, sphereURL, disposition, "LoginFetch_aspx_searchvalue_622613001_US_EN.pdf"},
+		{[]string{"header"}, sphereURL, nil, "622613001_us_en.pdf"}, // No source has a name, so URLToFilename
+	}
+	for _, test := range tests {
+		sources, err := ParseNameSources(test.sources)
+		if err != nil {
+			t.Fatal(err)
+		}
+		downloader := newTestDownloader(t, nil, Config{NameSources: sources})
+		if got := downloader.filenameFor(test.url, test.header); got != test.want {
+			t.Errorf("sources %v, %s, header %v: %s, want %s", test.sources, test.url, test.header != nil, got, test.want)
+		}
+	}
+
+	if _, err := ParseNameSources([]string{"header", "path"}); err == nil {
+		t.Error(`ParseNameSources accepted "path"`)
+	}
+}
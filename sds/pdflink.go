@@ -0,0 +1,74 @@
+package sds
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp" // DOM node types
+	"github.com/chromedp/chromedp"    // External package to control Chrome/Chromium browser
+)
+
+// Elements that can point at the PDF shown by a viewer page
+const pdfLinkSelector = "embed[src], iframe[src], object[data], a[href]"
+
+// Returns the direct PDF link found in the page currently loaded in ctx, or
+// pageURL itself when the page is already a PDF or no link can be found
+func extractPDFLink(ctx context.Context, pageURL string) string {
+	if looksLikePDF(pageURL) {
+		return pageURL
+	}
+	var nodes []*cdp.Node
+	if err := chromedp.Run(ctx, chromedp.Nodes(pdfLinkSelector, &nodes, chromedp.ByQueryAll, chromedp.AtLeast(0))); err != nil {
+		slog.Debug("Failed to search page for a PDF link", "url", pageURL, "error", err)
+		return pageURL
+	}
+	if link := pdfLinkFromNodes(pageURL, nodes); link != "" {
+		slog.Debug("Found PDF link in page", "url", pageURL, "link", link)
+		return link
+	}
+	return pageURL
+}
+
+// Returns the first absolute PDF link among the nodes, resolved against pageURL.
+// Embedded viewers count when they declare a PDF type or their source looks like
+// one; anchors count when they look like a PDF or carry a download attribute.
+func pdfLinkFromNodes(pageURL string, nodes []*cdp.Node) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	for _, node := range nodes {
+		var reference string
+		var isPDF bool
+		switch node.LocalName {
+		case "embed", "iframe":
+			reference = node.AttributeValue("src")
+			isPDF = strings.Contains(strings.ToLower(node.AttributeValue("type")), "pdf")
+		case "object":
+			reference = node.AttributeValue("data")
+			isPDF = strings.Contains(strings.ToLower(node.AttributeValue("type")), "pdf")
+		case "a":
+			reference = node.AttributeValue("href")
+			_, isPDF = node.Attribute("download")
+		}
+		link, err := base.Parse(strings.TrimSpace(reference))
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+			continue // Skip javascript:, about:blank, data: and broken references
+		}
+		if isPDF || looksLikePDF(link.String()) {
+			return link.String()
+		}
+	}
+	return ""
+}
+
+// Reports whether a URL's path names a PDF file
+func looksLikePDF(rawURL string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(parsedURL.Path), ".pdf")
+}
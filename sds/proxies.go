@@ -0,0 +1,141 @@
+package sds
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/chromedp/chromedp"    // External package to control Chrome/Chromium browser
+	"golang.org/x/net/http/httpproxy" // Proxy environment variables, as net/http reads them
+)
+
+// ProxyRotation selects the order in which Config.Proxies are used
+type ProxyRotation string
+
+const (
+	ProxyRoundRobin ProxyRotation = "round-robin" // Each proxy in turn
+	ProxyRandom     ProxyRotation = "random"      // A random proxy every time
+)
+
+// ParseProxyRotation checks a rotation name given on the command line
+func ParseProxyRotation(name string) (ProxyRotation, error) {
+	switch rotation := ProxyRotation(name); rotation {
+	case ProxyRoundRobin, ProxyRandom:
+		return rotation, nil
+	}
+	return "", fmt.Errorf("unknown proxy rotation %q (want %q or %q)", name, ProxyRoundRobin, ProxyRandom)
+}
+
+// Hands out the proxies of Config.Proxies, or the single Config.ProxyURL, to
+// download requests and browser launches
+type proxyPool struct {
+	proxies []*url.URL    // Proxies to rotate through; a single nil entry means direct
+	random  bool          // Pick at random instead of round-robin
+	next    atomic.Uint64 // Index of the next proxy in round-robin order
+}
+
+// Creates a pool rotating through Config.Proxies, falling back to Config.ProxyURL
+func newProxyPool(config Config) *proxyPool {
+	proxies := config.Proxies
+	if len(proxies) == 0 {
+		proxies = []*url.URL{config.ProxyURL}
+	}
+	return &proxyPool{proxies: proxies, random: config.ProxyRotation == ProxyRandom}
+}
+
+// Reports whether any traffic goes through a proxy
+func (pool *proxyPool) enabled() bool {
+	return len(pool.proxies) > 1 || pool.proxies[0] != nil
+}
+
+// Returns the index of the proxy to use next
+func (pool *proxyPool) pick() int {
+	if pool.random {
+		return rand.IntN(len(pool.proxies))
+	}
+	return int((pool.next.Add(1) - 1) % uint64(len(pool.proxies)))
+}
+
+// Picks the proxy of a single download request, as http.Transport.Proxy
+func (pool *proxyPool) forRequest(*http.Request) (*url.URL, error) {
+	return pool.proxies[pool.pick()], nil
+}
+
+// Returns the Chrome options sending browser traffic through proxyURL, or
+// through the proxies of the environment variables when it is nil. Chrome
+// ignores credentials in --proxy-server, so they are left out of it, where
+// they would show in process lists, and given when the proxy asks for them.
+func (downloader *Downloader) proxyOptions(proxyURL *url.URL) []chromedp.ExecAllocatorOption {
+	if proxyURL != nil {
+		return []chromedp.ExecAllocatorOption{chromedp.ProxyServer(withoutUserinfo(proxyURL))}
+	}
+	env := httpproxy.FromEnvironment()
+	servers, bypass := environmentProxyRules(env)
+	if servers == "" {
+		return nil // No proxy variables, or NO_PROXY=*; connect directly
+	}
+	downloader.auth.addProxy(parseEnvironmentProxy(env.HTTPProxy))
+	downloader.auth.addProxy(parseEnvironmentProxy(env.HTTPSProxy))
+	options := []chromedp.ExecAllocatorOption{chromedp.ProxyServer(servers)}
+	if bypass != "" {
+		options = append(options, chromedp.Flag("proxy-bypass-list", bypass))
+	}
+	return options
+}
+
+// Translates proxy environment variables into Chrome's --proxy-server rules
+// ("http=…;https=…") and --proxy-bypass-list, matching the hosts NO_PROXY
+// leaves out for net/http: "example.com" covers its subdomains too, and
+// ".example.com" only them
+func environmentProxyRules(env *httpproxy.Config) (servers, bypass string) {
+	if strings.TrimSpace(env.NoProxy) == "*" {
+		return "", ""
+	}
+	var rules []string
+	for _, scheme := range []struct{ name, rawProxy string }{{"http", env.HTTPProxy}, {"https", env.HTTPSProxy}} {
+		if proxyURL := parseEnvironmentProxy(scheme.rawProxy); proxyURL != nil {
+			rules = append(rules, scheme.name+"="+withoutUserinfo(proxyURL))
+		}
+	}
+	var bypassRules []string
+	for _, host := range strings.Split(env.NoProxy, ",") {
+		switch host = strings.ToLower(strings.TrimSpace(host)); {
+		case host == "":
+		case strings.HasPrefix(host, "."):
+			bypassRules = append(bypassRules, "*"+host)
+		case strings.HasPrefix(host, "*.") || strings.ContainsAny(host, ":/") || net.ParseIP(host) != nil:
+			bypassRules = append(bypassRules, host) // Patterns, ports, addresses and CIDR ranges read the same in Chrome
+		default:
+			bypassRules = append(bypassRules, host, "*."+host)
+		}
+	}
+	return strings.Join(rules, ";"), strings.Join(bypassRules, ";")
+}
+
+// Parses a proxy environment variable the way net/http does, where a bare
+// "host:port" means an HTTP proxy; returns nil for an empty or invalid value
+func parseEnvironmentProxy(rawProxy string) *url.URL {
+	rawProxy = strings.TrimSpace(rawProxy)
+	if rawProxy == "" {
+		return nil
+	}
+	if !strings.Contains(rawProxy, "://") {
+		rawProxy = "http://" + rawProxy
+	}
+	proxyURL, err := url.Parse(rawProxy)
+	if err != nil || proxyURL.Host == "" {
+		return nil
+	}
+	return proxyURL
+}
+
+// Returns proxyURL as a string without its "user:pass@" part
+func withoutUserinfo(proxyURL *url.URL) string {
+	stripped := *proxyURL
+	stripped.User = nil
+	return stripped.String()
+}
@@ -0,0 +1,269 @@
+package sds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation" // Per-tab User-Agent override
+	"github.com/chromedp/chromedp"          // External package to control Chrome/Chromium browser
+)
+
+// ErrRedirectLoop is returned when resolving a URL keeps cycling between pages
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// Resolve navigates to a given URL using headless Chrome
+// and follows all redirects (HTTP, meta refresh, JS) until the URL stabilizes.
+// LoginFetch URLs first try the direct URL of Config.DirectURL, if set.
+// Results are cached on disk for Config.CacheTTL unless Config.NoCache is set.
+// Failures are returned as a *DownloadError.
+func (downloader *Downloader) Resolve(ctx context.Context, inputURL string) (string, error) {
+	inputURL = downloader.StripCredentials(inputURL)
+	resolvedURL, err := downloader.resolve(ctx, inputURL)
+	if err == nil {
+		downloader.sources.follow(inputURL, resolvedURL) // Name the download after the input's metadata
+	}
+	return resolvedURL, classify(inputURL, err, KindBrowser)
+}
+
+// Does the work of Resolve
+func (downloader *Downloader) resolve(ctx context.Context, inputURL string) (string, error) {
+	if !downloader.NoCache {
+		if cachedURL, ok := downloader.resolved.lookup(inputURL, downloader.CacheTTL); ok {
+			slog.Debug("Using cached resolution", "url", inputURL, "resolved", cachedURL)
+			return cachedURL, nil
+		}
+	}
+
+	if directURL, ok := downloader.resolveDirect(ctx, inputURL); ok { // Skips Chrome entirely
+		downloader.resolved.record(inputURL, directURL)
+		return directURL, nil
+	}
+
+	resolvedURL, err := downloader.resolveWithRetries(ctx, inputURL)
+	if errors.Is(err, ErrBlocked) && downloader.BlockedRetryDelay > 0 { // Warming-up servers may show an error page once
+		slog.Info("Resolved to a blocked page; trying once more", "url", inputURL, "delay", downloader.BlockedRetryDelay, "error", err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(downloader.BlockedRetryDelay):
+		}
+		resolvedURL, err = downloader.resolveWithRetries(ctx, inputURL)
+	}
+	if err != nil {
+		return "", err
+	}
+	downloader.resolved.record(inputURL, resolvedURL) // Refreshed even with NoCache
+	return resolvedURL, nil
+}
+
+// Resolves inputURL in the browser, retrying transient failures such as a
+// crashed tab or a page that timed out up to Config.NavigateRetries times with
+// exponential backoff. Each attempt runs in a fresh tab.
+func (downloader *Downloader) resolveWithRetries(ctx context.Context, inputURL string) (string, error) {
+	delay := downloader.NavigateBackoff
+	for attempt := 1; ; attempt++ {
+		release, err := downloader.startRequest(ctx, inputURL)
+		if err != nil {
+			return "", err
+		}
+		resolvedURL, err := downloader.resolveInBrowser(ctx, inputURL)
+		release()
+		if err == nil || attempt > downloader.NavigateRetries || !retryableNavigation(ctx, err, delay) {
+			return resolvedURL, err
+		}
+		slog.Warn("Retrying navigation", "url", inputURL, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Reports whether a failed navigation is worth another attempt after delay. A
+// redirect loop will loop again and a blocked page will block again, and once
+// the caller's own context is done or its deadline would pass during the wait
+// there is no time left to retry.
+func retryableNavigation(ctx context.Context, err error, delay time.Duration) bool {
+	if errors.Is(err, ErrRedirectLoop) || errors.Is(err, ErrBlocked) || ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+	return true // Includes the per-tab NavigateTimeout, which a fresh tab resets
+}
+
+// Follows the redirects of inputURL in a tab of the shared headless Chrome
+func (downloader *Downloader) resolveInBrowser(ctx context.Context, inputURL string) (resolvedURL string, err error) {
+	agent := downloader.agents.pick() // Reused by Download for the resolved URL
+	sourceURL := inputURL             // inputURL follows the redirects below
+
+	// A tab of its own (pooled or new); closing it leaves the browser and other tabs running
+	tab, err := downloader.borrowTab()
+	if err != nil {
+		return "", fmt.Errorf("start browser: %w", err)
+	}
+	defer func() { downloader.returnTab(tab, tabReusable(err)) }()
+	tabCtx := tab.ctx
+	stopAuth, err := downloader.answerAuthChallenges(tabCtx)
+	if err != nil {
+		return "", err
+	}
+	defer stopAuth()
+	stop := context.AfterFunc(ctx, tab.cancel) // Close the tab when the caller gives up
+	defer stop()
+
+	// At debug level, explain failures with the console errors and failed requests
+	// of the tab, listening only while this URL has it, as a pooled tab lives on
+	watchCtx, stopWatching := context.WithCancel(tabCtx)
+	defer stopWatching()
+	problems := watchPageProblems(ctx, watchCtx)
+	defer func() {
+		if err != nil {
+			problems.logFailure(sourceURL, err)
+		}
+	}()
+
+	// Each URL gets its own deadline, independent of how long earlier URLs took
+	ctx, cancel := context.WithTimeout(tabCtx, downloader.NavigateTimeout)
+	defer cancel()
+
+	// The User-Agent is set per tab, since the browser is shared across the rotation
+	if err := chromedp.Run(ctx, emulation.SetUserAgentOverride(agent)); err != nil {
+		return "", err
+	}
+
+	var currentURL string
+	trail := newRedirectTrail()
+	start := time.Now()
+
+	for hops := 1; ; hops++ {
+		// Navigate and capture URL
+		err := chromedp.Run(ctx,
+			chromedp.Navigate(inputURL),
+			chromedp.WaitReady("body", chromedp.ByQuery),
+			downloader.settle(inputURL), // let JS/meta redirects fire
+			chromedp.Location(&currentURL),
+		)
+		if err != nil {
+			return "", err
+		}
+
+		// Stop if URL has stabilized, or fail if it cycles back to an earlier one
+		settled, err := trail.land(currentURL)
+		if err != nil {
+			return "", err
+		}
+		if settled {
+			return downloader.finishResolve(ctx, sourceURL, currentURL, agent)
+		}
+
+		// Prepare for next loop
+		inputURL = currentURL
+
+		// Safety cutoff
+		if time.Since(start) > downloader.RedirectLoopTimeout {
+			slog.Warn("Redirect loop timeout", "url", currentURL)
+			return downloader.finishResolve(ctx, sourceURL, currentURL, agent)
+		}
+
+		// Cap the navigations for pages that keep changing their URL slightly
+		if downloader.MaxRedirects > 0 && hops >= downloader.MaxRedirects {
+			slog.Warn("Redirect limit reached", "url", currentURL, "max", downloader.MaxRedirects)
+			return downloader.finishResolve(ctx, sourceURL, currentURL, agent)
+		}
+	}
+}
+
+// The URLs a resolution has landed on, in order
+type redirectTrail struct {
+	last    string          // URL of the latest navigation
+	visited map[string]bool // Every URL landed on so far, to catch A→B→A cycles
+}
+
+// Creates an empty trail
+func newRedirectTrail() *redirectTrail {
+	return &redirectTrail{visited: make(map[string]bool)}
+}
+
+// Records the URL a navigation ended on. It reports whether the URL is the
+// same as the previous one, so the page has settled, and fails with
+// ErrRedirectLoop when it is an earlier URL coming round again.
+func (trail *redirectTrail) land(currentURL string) (bool, error) {
+	if currentURL == trail.last {
+		return true, nil
+	}
+	if trail.visited[currentURL] {
+		return false, fmt.Errorf("%w: %s was revisited", ErrRedirectLoop, currentURL)
+	}
+	trail.visited[currentURL] = true
+	trail.last = currentURL
+	return false, nil
+}
+
+// How often settle checks the tab's URL
+const settlePollInterval = 250 * time.Millisecond
+
+// Returns an action that waits for JS/meta redirects after pageURL loads. With
+// Config.FixedSettle it sleeps for RedirectSettleDelay; otherwise it polls the
+// URL and returns once it has stayed the same for SettleStable, or after SettleMax.
+// A Config.HostSettle entry for the page's host replaces the sleep or SettleMax.
+func (downloader *Downloader) settle(pageURL string) chromedp.Action {
+	limit, perHost := downloader.HostSettle.forURL(pageURL)
+	if downloader.FixedSettle {
+		if !perHost {
+			limit = downloader.RedirectSettleDelay
+		}
+		return chromedp.Sleep(limit)
+	}
+	if !perHost {
+		limit = downloader.SettleMax
+	}
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		start := time.Now()
+		var lastURL string
+		stableSince := start
+		for {
+			var currentURL string
+			if err := chromedp.Location(&currentURL).Do(ctx); err != nil {
+				return err
+			}
+			now := time.Now()
+			if currentURL != lastURL {
+				lastURL, stableSince = currentURL, now
+			}
+			if now.Sub(stableSince) >= downloader.SettleStable || now.Sub(start) >= limit {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(settlePollInterval):
+			}
+		}
+	})
+}
+
+// Returns the URL to download for a resolved page, preferring a PDF link found
+// in its DOM when Config.ExtractPDFLink is set, and hands its User-Agent and
+// cookies on to the download. A page that turns out to be an access-denied,
+// captcha or login wall fails with ErrBlocked instead. With Config.SaveHTMLDir
+// set, a page that isn't a PDF is saved there first.
+func (downloader *Downloader) finishResolve(ctx context.Context, sourceURL, pageURL, agent string) (string, error) {
+	downloader.saveResolvedHTML(ctx, sourceURL, pageURL)
+	if err := downloader.checkBlocked(ctx, pageURL); err != nil {
+		return "", err
+	}
+	resolvedURL := pageURL
+	if downloader.ExtractPDFLink {
+		resolvedURL = extractPDFLink(ctx, pageURL)
+	}
+	downloader.agents.remember(resolvedURL, agent)
+	downloader.shareBrowserCookies(ctx, sourceURL, pageURL, resolvedURL)
+	return resolvedURL, nil
+}
@@ -0,0 +1,202 @@
+package sds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns a Downloader resolving in a fresh Chrome, skipping the test or
+// benchmark when Chrome can't be started
+func newBrowserDownloader(tb testing.TB, config Config) *Downloader {
+	tb.Helper()
+	config.OutputDir = tb.TempDir()
+	config.NoCache = true
+	if config.NavigateTimeout == 0 {
+		config.NavigateTimeout = 10 * time.Second
+	}
+	config.SettleStable = 50 * time.Millisecond
+	config.SettleMax = time.Second
+	config.RedirectLoopTimeout = 10 * time.Second
+	downloader := New(config)
+	tb.Cleanup(func() { downloader.Close() })
+	if _, err := downloader.browserContext(); err != nil { // Launches Chrome, and warms any pool
+		tb.Skipf("Chrome not available: %v", err)
+	}
+	return downloader
+}
+
+func TestRedirectTrail(t *testing.T) {
+	const (
+		a = "https://apps.spheracloud.net/LoginFetch.aspx?searchvalue=622613001_US_EN"
+		b = "https://apps.spheracloud.net/Login.aspx"
+		c = "https://apps.spheracloud.net/ViewFetch.aspx?id=1"
+	)
+	tests := []struct {
+		name    string
+		landed  []string // URLs the tab ends on after each navigation
+		settled bool     // Whether the last one settles the page
+		loop    bool     // Whether the last one is a redirect loop
+	}{
+		{"stable at once", []string{a, a}, true, false},
+		{"one redirect", []string{a, c, c}, true, false},
+		{"oscillation", []string{a, b, a}, false, true},
+		{"longer cycle", []string{a, b, c, b}, false, true},
+		{"still moving", []string{a, b, c}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trail := newRedirectTrail()
+			for i, landed := range test.landed {
+				settled, err := trail.land(landed)
+				if i < len(test.landed)-1 {
+					if settled || err != nil {
+						t.Fatalf("stopped early at hop %d: settled = %v, error = %v", i+1, settled, err)
+					}
+					continue
+				}
+				if settled != test.settled || errors.Is(err, ErrRedirectLoop) != test.loop {
+					t.Errorf("last hop: settled = %v, error = %v; want settled = %v, loop = %v", settled, err, test.settled, test.loop)
+				}
+				if test.loop && !strings.Contains(err.Error(), landed) {
+					t.Errorf("error %q doesn't name the revisited URL", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryableNavigation(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	soon, cancelSoon := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelSoon()
+	later, cancelLater := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelLater()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"redirect loop", context.Background(), fmt.Errorf("%w: https://a.example/ was revisited", ErrRedirectLoop), false},
+		{"blocked", context.Background(), fmt.Errorf("%w: captcha", ErrBlocked), false},
+		{"caller gave up", canceled, context.Canceled, false},
+		{"deadline before the delay ends", soon, context.DeadlineExceeded, false},
+		{"tab timeout", context.Background(), context.DeadlineExceeded, true},
+		{"tab timeout with time left", later, context.DeadlineExceeded, true},
+		{"crashed tab", context.Background(), errors.New("net::ERR_EMPTY_RESPONSE"), true},
+	}
+	for _, test := range tests {
+		if got := retryableNavigation(test.ctx, test.err, time.Second); got != test.want {
+			t.Errorf("%s: retryableNavigation = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestResolveRetries(t *testing.T) {
+	const (
+		failures = 2
+		backoff  = 200 * time.Millisecond
+	)
+	var mu sync.Mutex
+	var attempts []time.Time // When each navigation to the page arrived
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/flaky" {
+			http.NotFound(w, r) // favicon.ico and the like
+			return
+		}
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		failed := len(attempts) <= failures
+		mu.Unlock()
+		if failed { // Drop the connection, which fails the navigation
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>SDS</body></html>"))
+	}))
+	defer server.Close()
+	downloader := newBrowserDownloader(t, Config{NavigateRetries: failures, NavigateBackoff: backoff})
+
+	navigations := func() []time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Time(nil), attempts...)
+	}
+
+	resolvedURL, err := downloader.Resolve(context.Background(), server.URL+"/flaky")
+	if err != nil || resolvedURL != server.URL+"/flaky" {
+		t.Fatalf("Resolve = %q, %v; want the page after %d retries", resolvedURL, err, failures)
+	}
+	arrived := navigations()
+	if len(arrived) != failures+1 {
+		t.Fatalf("server saw %d navigations, want %d", len(arrived), failures+1)
+	}
+	for i := 1; i < len(arrived); i++ {
+		delay := backoff << (i - 1) // Doubled for each retry
+		if gap := arrived[i].Sub(arrived[i-1]); gap < delay {
+			t.Errorf("retry %d came %v after the previous attempt, want at least %v", i, gap, delay)
+		}
+	}
+
+	// Without retries the first failure is final
+	mu.Lock()
+	attempts = nil
+	mu.Unlock()
+	downloader = newBrowserDownloader(t, Config{NavigateBackoff: backoff})
+	if _, err := downloader.Resolve(context.Background(), server.URL+"/flaky"); err == nil || len(navigations()) != 1 {
+		t.Errorf("with no retries: error = %v after %d navigations, want a failure after 1", err, len(navigations()))
+	}
+}
+
+func TestResolveTimeoutPerURL(t *testing.T) {
+	const timeout = 2 * time.Second
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hang": // Starts the response but never finishes the page
+			w.Header().Set("Content-Type", "text/html")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-stop:
+			}
+		case "/ok":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>SDS</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+	downloader := newBrowserDownloader(t, Config{NavigateTimeout: timeout})
+
+	start := time.Now()
+	_, err := downloader.Resolve(context.Background(), server.URL+"/hang")
+	if kind := ErrorKindOf(err); kind != KindTimeout {
+		t.Errorf("hanging page: error kind = %q (%v), want %q", kind, err, KindTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > 3*timeout {
+		t.Errorf("hanging page gave up after %v, want about its %v timeout", elapsed, timeout)
+	}
+
+	// The next URL gets a deadline of its own, not what the hanging one left over
+	start = time.Now()
+	if resolvedURL, err := downloader.Resolve(context.Background(), server.URL+"/ok"); err != nil || resolvedURL != server.URL+"/ok" {
+		t.Errorf("next URL: Resolve = %q, %v; want it resolved", resolvedURL, err)
+	}
+	if elapsed := time.Since(start); elapsed > timeout {
+		t.Errorf("next URL took %v, want it within its own %v", elapsed, timeout)
+	}
+}
@@ -0,0 +1,107 @@
+package sds
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Name of the file inside OutputDir holding previously resolved URLs
+const resolveCacheFilename = ".sds-resolve-cache.json"
+
+// A source URL's redirect target as resolved by the browser
+type resolvedEntry struct {
+	ResolvedURL string    `json:"resolved_url"` // Final URL after all redirects
+	ResolvedAt  time.Time `json:"resolved_at"`  // When the browser resolved it
+}
+
+// Persistent map of source URLs to their resolved URLs, so re-runs can skip Chrome
+type resolveCache struct {
+	mu      sync.Mutex               // Guards entries and the file on disk
+	path    string                   // Location of the JSON file
+	loaded  bool                     // Whether entries were read from disk yet
+	entries map[string]resolvedEntry // Source URL → resolution
+	dirty   bool                     // Whether entries changed since the last save
+	saved   time.Time                // When entries were last written
+}
+
+// Creates a cache backed by the cache file in outputDir; it is read on first use
+func newResolveCache(outputDir string) *resolveCache {
+	return &resolveCache{path: filepath.Join(outputDir, resolveCacheFilename), saved: time.Now()}
+}
+
+// Reads the cache from disk once; must be called with mu held
+func (cache *resolveCache) load() {
+	if cache.loaded {
+		return
+	}
+	cache.loaded = true
+	cache.entries = make(map[string]resolvedEntry)
+	if err := readJSONFile(cache.path, &cache.entries); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Ignoring unreadable resolve cache", "path", cache.path, "error", err)
+		cache.entries = make(map[string]resolvedEntry)
+	}
+}
+
+// Returns the resolved URL cached for sourceURL if it is younger than ttl
+func (cache *resolveCache) lookup(sourceURL string, ttl time.Duration) (string, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.load()
+	entry, ok := cache.entries[sourceURL]
+	if !ok || time.Since(entry.ResolvedAt) > ttl {
+		return "", false
+	}
+	return entry.ResolvedURL, true
+}
+
+// Records a fresh resolution, saving the cache if the last save is older than saveInterval
+func (cache *resolveCache) record(sourceURL, resolvedURL string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.load()
+	cache.entries[sourceURL] = resolvedEntry{ResolvedURL: resolvedURL, ResolvedAt: time.Now().UTC()}
+	cache.dirty = true
+	if time.Since(cache.saved) >= saveInterval {
+		cache.save()
+	}
+}
+
+// Writes entries to disk; must be called with mu held
+func (cache *resolveCache) save() {
+	cache.saved = time.Now()
+	if !DirectoryExists(filepath.Dir(cache.path)) {
+		return // Dry runs don't create the output directory, so keep the entries in memory only
+	}
+	cache.dirty = false
+	if err := writeJSONFile(cache.path, cache.entries); err != nil {
+		slog.Warn("Failed to save resolve cache", "path", cache.path, "error", err)
+	}
+}
+
+// Writes any resolutions recorded since the last save
+func (cache *resolveCache) flush() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.dirty {
+		cache.save()
+	}
+}
+
+// ClearResolveCache deletes the resolve cache in outputDir, so every URL is
+// resolved in the browser again, and returns how many entries it held. A
+// missing cache is not an error.
+func ClearResolveCache(outputDir string) (int, error) {
+	path := filepath.Join(outputDir, resolveCacheFilename)
+	entries := make(map[string]resolvedEntry)
+	if err := readJSONFile(path, &entries); errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	return len(entries), nil
+}
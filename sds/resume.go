@@ -0,0 +1,62 @@
+package sds
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Returns how many bytes an interrupted earlier download left in partialPath
+func partialSize(partialPath string) int64 {
+	info, err := os.Stat(partialPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+// Keeps the partial file holding the bytes received before a transfer broke
+// off, so the next run can resume with a Range request. It is deleted when
+// nothing arrived or the server can't resume.
+func keepPartial(partialPath string, resp *http.Response, received int64) {
+	if received == 0 ||
+		(resp.StatusCode != http.StatusPartialContent && resp.Header.Get("Accept-Ranges") != "bytes") {
+		discardPartial(partialPath)
+		return
+	}
+	slog.Info("Kept partial download for resuming", "path", partialPath, "bytes", received)
+}
+
+// Deletes a partial download that can't or needn't be resumed
+func discardPartial(partialPath string) {
+	if err := RemoveFile(partialPath); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove partial file", "path", partialPath, "error", err)
+	}
+}
+
+// Checks that a 206 response continues exactly where the partial file ends and
+// returns the full document size it announces (-1 if unknown)
+func checkContentRange(resp *http.Response, offset int64) (int64, error) {
+	// Content-Range looks like "bytes 1000-4999/5000"; the total may be "*"
+	contentRange := strings.TrimSpace(resp.Header.Get("Content-Range"))
+	span, total, found := strings.Cut(strings.TrimPrefix(contentRange, "bytes "), "/")
+	startText, _, _ := strings.Cut(span, "-")
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if !found || err != nil {
+		return 0, fmt.Errorf("malformed Content-Range %q", contentRange)
+	}
+	if start != offset {
+		return 0, fmt.Errorf("server resumed at byte %d instead of %d", start, offset)
+	}
+	if total == "*" {
+		return -1, nil
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed Content-Range %q", contentRange)
+	}
+	return size, nil
+}
@@ -0,0 +1,62 @@
+package sds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadRestartsUnsatisfiableRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		always416 bool // Answer 416 to plain requests too
+		status    Status
+		requests  int32
+	}{
+		{"restarts without range", false, StatusDownloaded, 2},
+		{"fails when the restart is refused too", true, StatusFailed, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var rangedRetry atomic.Bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) > 1 && r.Header.Get("Range") != "" {
+					rangedRetry.Store(true)
+				}
+				if r.Header.Get("Range") != "" || test.always416 {
+					w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+				w.Header().Set("Content-Type", "application/pdf")
+				w.Write([]byte(testPDF))
+			}))
+			defer server.Close()
+			downloader := newTestDownloader(t, server, Config{})
+			partialPath := filepath.Join(downloader.OutputDir, "doc.pdf.part")
+			if err := os.WriteFile(partialPath, []byte("%PDF-1.3 from another version"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := downloader.Download(context.Background(), server.URL+"/doc.pdf")
+			if result.Status != test.status {
+				t.Errorf("status = %v (error %v), want %v", result.Status, err, test.status)
+			}
+			if got := requests.Load(); got != test.requests {
+				t.Errorf("server saw %d requests, want %d", got, test.requests)
+			}
+			if rangedRetry.Load() {
+				t.Error("the restart sent a Range header")
+			}
+			if test.status == StatusDownloaded {
+				if content, _ := os.ReadFile(result.Path); string(content) != testPDF {
+					t.Errorf("saved %q, want the full document", content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package sds
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/temoto/robotstxt" // robots.txt parsing and matching
+)
+
+// Largest robots.txt body that is parsed; the rest is ignored, as crawlers commonly do
+const maxRobotsSize = 512 << 10
+
+// Caches the parsed robots.txt of every site visited during a run
+type robotsCache struct {
+	mu    sync.Mutex             // Guards sites
+	sites map[string]*robotsSite // "scheme://host" → its rules
+}
+
+// The rules of one site, fetched by the first URL that needs them while
+// other URLs of the site wait; URLs of other sites don't
+type robotsSite struct {
+	once  sync.Once             // Fetches robots.txt once
+	rules *robotstxt.RobotsData // Parsed rules, set by once
+}
+
+// Creates an empty cache
+func newRobotsCache() *robotsCache {
+	return &robotsCache{sites: make(map[string]*robotsSite)}
+}
+
+// Allowed reports whether robots.txt permits fetching rawURL with the User-Agent
+// that will be sent for it. It always returns true when Config.IgnoreRobots is set.
+// Each site's robots.txt is fetched once and cached for the Downloader's lifetime.
+func (downloader *Downloader) Allowed(ctx context.Context, rawURL string) bool {
+	if downloader.IgnoreRobots {
+		return true
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		return true // Nothing to check; the request itself will fail later
+	}
+	rules := downloader.robotsFor(ctx, parsedURL)
+	return rules.TestAgent(parsedURL.RequestURI(), downloader.agents.peek(rawURL))
+}
+
+// Returns the cached rules for the URL's site, fetching robots.txt on first use.
+// Rules are kept per host rather than per base domain, because every subdomain
+// (e.g. www.docs.citgo.com vs citgo.com) serves its own robots.txt.
+func (downloader *Downloader) robotsFor(ctx context.Context, parsedURL *url.URL) *robotstxt.RobotsData {
+	site := parsedURL.Scheme + "://" + parsedURL.Host
+
+	downloader.robots.mu.Lock()
+	entry, ok := downloader.robots.sites[site]
+	if !ok {
+		entry = &robotsSite{}
+		downloader.robots.sites[site] = entry
+	}
+	downloader.robots.mu.Unlock()
+
+	entry.once.Do(func() { // Each site is requested once, without holding up the others
+		rules, err := downloader.fetchRobots(ctx, site)
+		if err != nil {
+			slog.Debug("Failed to fetch robots.txt, allowing all", "site", site, "error", err)
+			rules, _ = robotstxt.FromStatusAndBytes(http.StatusNotFound, nil) // Missing robots.txt allows everything
+		}
+		entry.rules = rules
+	})
+	return entry.rules
+}
+
+// Downloads and parses robots.txt for a site. Following the usual convention, a
+// 4xx answer allows everything and a 5xx answer disallows everything.
+func (downloader *Downloader) fetchRobots(ctx context.Context, site string) (*robotstxt.RobotsData, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", site+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", downloader.agents.peek(site))
+
+	resp, err := downloader.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		return nil, err
+	}
+	return robotstxt.FromStatusAndBytes(resp.StatusCode, body)
+}
@@ -0,0 +1,63 @@
+package sds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRobotsPerSite(t *testing.T) {
+	release := make(chan struct{})
+	var slowFetches atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowFetches.Add(1)
+		<-release // A robots.txt that takes its time
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer fast.Close()
+	downloader := newTestDownloader(t, nil, Config{})
+
+	var wg sync.WaitGroup
+	slowAllowed := make([]bool, 3)
+	for i := range slowAllowed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slowAllowed[i] = downloader.Allowed(context.Background(), slow.URL+"/private/doc.pdf")
+		}()
+	}
+	for slowFetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Another site is answered while the first one's robots.txt is still loading
+	done := make(chan bool)
+	go func() { done <- downloader.Allowed(context.Background(), fast.URL+"/msds_pi/C10005B.pdf") }()
+	select {
+	case allowed := <-done:
+		if !allowed {
+			t.Error("public path of the other site disallowed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("other site waited for the slow robots.txt")
+	}
+
+	close(release)
+	wg.Wait()
+	for i, allowed := range slowAllowed {
+		if allowed {
+			t.Errorf("caller %d allowed a disallowed path", i)
+		}
+	}
+	if got := slowFetches.Load(); got != 1 {
+		t.Errorf("slow robots.txt fetched %d times, want once", got)
+	}
+}
@@ -0,0 +1,45 @@
+package sds
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/chromedp/chromedp" // External package to control Chrome/Chromium browser
+)
+
+// Saves the markup of a resolved page that is not a PDF to Config.SaveHTMLDir,
+// so it can be inspected to see what link extraction would need. Failures are
+// only logged, as the page is kept for debugging.
+func (downloader *Downloader) saveResolvedHTML(ctx context.Context, sourceURL, pageURL string) {
+	if downloader.SaveHTMLDir == "" || looksLikePDF(pageURL) {
+		return
+	}
+	var html string
+	if err := chromedp.Run(ctx, chromedp.OuterHTML("html", &html, chromedp.ByQuery)); err != nil {
+		slog.Warn("Failed to read page HTML", "url", sourceURL, "page", pageURL, "error", err)
+		return
+	}
+	if err := CreateDirectory(downloader.SaveHTMLDir, 0o755); err != nil {
+		slog.Warn("Failed to create HTML directory", "path", downloader.SaveHTMLDir, "error", err)
+		return
+	}
+	path := filepath.Join(downloader.SaveHTMLDir, htmlFilename(sourceURL))
+	if err := writeFileAtomically(path, []byte(html)); err != nil {
+		slog.Warn("Failed to save page HTML", "url", sourceURL, "path", path, "error", err)
+		return
+	}
+	slog.Info("Saved HTML of non-PDF page", "url", sourceURL, "page", pageURL, "path", path)
+}
+
+// Names the saved HTML of a page after the sanitized source URL
+// (e.g. "https_apps.spheracloud.net_loginfetch.aspx_searchvalue_622613001_us_en.html")
+func htmlFilename(sourceURL string) string {
+	name := unsafeNameCharacters.ReplaceAllString(strings.ToLower(sourceURL), "_")
+	name = strings.Trim(name, "._-")
+	if name == "" {
+		name = "page"
+	}
+	return shortenFilename(name, sourceURL) + ".html"
+}
@@ -0,0 +1,77 @@
+package sds
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"       // DOM node types
+	"github.com/chromedp/cdproto/emulation" // Per-tab User-Agent override
+	"github.com/chromedp/chromedp"          // External package to control Chrome/Chromium browser
+)
+
+// DefaultSeedPattern matches direct PDF links and spheracloud SDS fetch links
+const DefaultSeedPattern = `(?i)\.pdf([?#]|$)|spheracloud\.net/LoginFetch\.aspx\?`
+
+// ScrapeLinks loads an index page in the shared browser and returns the absolute
+// URLs of its anchors that match pattern, each once and in page order
+func (downloader *Downloader) ScrapeLinks(ctx context.Context, pageURL string, pattern *regexp.Regexp) ([]string, error) {
+	pageURL = downloader.StripCredentials(pageURL)
+	browserCtx, err := downloader.browserContext()
+	if err != nil {
+		return nil, fmt.Errorf("start browser: %w", err)
+	}
+	tabCtx, cancelTab := chromedp.NewContext(browserCtx)
+	defer cancelTab()
+	stopAuth, err := downloader.answerAuthChallenges(tabCtx)
+	if err != nil {
+		return nil, err
+	}
+	defer stopAuth()
+	stop := context.AfterFunc(ctx, cancelTab) // Close the tab when the caller gives up
+	defer stop()
+	ctx, cancel := context.WithTimeout(tabCtx, downloader.NavigateTimeout)
+	defer cancel()
+
+	var landedURL string
+	var nodes []*cdp.Node
+	err = chromedp.Run(ctx,
+		emulation.SetUserAgentOverride(downloader.agents.pick()),
+		chromedp.Navigate(pageURL),
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		downloader.settle(pageURL), // Let scripts redirect or render the list
+		chromedp.Location(&landedURL),
+		chromedp.Nodes("a[href]", &nodes, chromedp.ByQueryAll, chromedp.AtLeast(0)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	links := matchingLinks(landedURL, nodes, pattern)
+	slog.Info("Scraped seed page", "url", pageURL, "anchors", len(nodes), "links", len(links))
+	return links, nil
+}
+
+// Returns the hrefs of the anchor nodes, resolved against pageURL, that match pattern
+func matchingLinks(pageURL string, nodes []*cdp.Node, pattern *regexp.Regexp) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var links []string
+	for _, node := range nodes {
+		link, err := base.Parse(strings.TrimSpace(node.AttributeValue("href")))
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+			continue // Skip javascript:, mailto: and broken references
+		}
+		link.Fragment = "" // "#page=2" and the like point at the same document
+		if absolute := link.String(); pattern.MatchString(absolute) && !seen[absolute] {
+			seen[absolute] = true
+			links = append(links, absolute)
+		}
+	}
+	return links
+}
@@ -0,0 +1,117 @@
+package sds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Sink is a destination for downloaded documents other than OutputDir, such
+// as a bucket in cloud storage. Create opens the document called name, a path
+// relative to OutputDir with forward slashes (e.g. "c10005b.pdf"); it is
+// complete once Close returns nil. When a transfer fails, the writer's
+// Abort() error method is called instead of Close, if it has one.
+type Sink interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// FileSink is a Sink saving each document to a file under Dir. Bytes go to a
+// ".part" file that Close renames into place, so a failed transfer never
+// leaves a truncated document behind.
+type FileSink struct {
+	Dir string // Directory the names are relative to
+}
+
+// Create opens the ".part" file of name, creating missing parent directories
+func (sink FileSink) Create(name string) (io.WriteCloser, error) {
+	relative := filepath.FromSlash(name)
+	if !filepath.IsLocal(relative) { // Keep names like "../x.pdf" inside Dir
+		return nil, fmt.Errorf("invalid document name %q", name)
+	}
+	path := filepath.Join(sink.Dir, relative)
+	if err := CreateDirectory(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path + ".part")
+	if err != nil {
+		return nil, err
+	}
+	return &fileSinkWriter{file: file, path: path}, nil
+}
+
+// A document being written by a FileSink
+type fileSinkWriter struct {
+	file *os.File // The ".part" file
+	path string   // Where the document goes once complete
+}
+
+// Write appends to the ".part" file
+func (writer *fileSinkWriter) Write(data []byte) (int, error) {
+	return writer.file.Write(data)
+}
+
+// Close flushes the ".part" file to disk and moves it into place
+func (writer *fileSinkWriter) Close() error {
+	if err := errors.Join(writer.file.Sync(), writer.file.Close()); err != nil {
+		os.Remove(writer.file.Name())
+		return err
+	}
+	return os.Rename(writer.file.Name(), writer.path)
+}
+
+// Abort deletes the ".part" file
+func (writer *fileSinkWriter) Abort() error {
+	writer.file.Close()
+	return os.Remove(writer.file.Name())
+}
+
+// Streams a document into Downloader.Sink instead of OutputDir, hashing it on the
+// way. There is no local copy, so nothing is resumed and Config.ValidatePDF,
+// which needs the whole file at hand, does not apply.
+func (downloader *Downloader) saveToSink(result Result, body io.Reader) (Result, error) {
+	name, err := filepath.Rel(downloader.OutputDir, result.Path)
+	if err != nil {
+		name = filepath.Base(result.Path)
+	}
+	downloader.writeMu.Lock()
+	downloader.claims.claim(result.Path, result.URL) // Later URLs with the same name get their own
+	downloader.writeMu.Unlock()
+	name = filepath.ToSlash(name)
+	result.Path = name // Like archive entries, documents in a sink are known by their name
+
+	out, err := downloader.Sink.Create(name)
+	if err != nil {
+		return result, fmt.Errorf("create %s in sink: %w", name, err)
+	}
+	digest := sha256.New() // Checksum computed while the body streams in
+	var limited io.Reader = body
+	if downloader.MaxSize > 0 { // One byte over the limit tells a huge body apart from one that fits exactly
+		limited = io.LimitReader(body, downloader.MaxSize+1)
+	}
+	written, err := io.Copy(io.MultiWriter(out, digest), limited)
+	if err != nil {
+		err = fmt.Errorf("copy PDF data to sink: %w", err)
+	} else {
+		err = downloader.checkSize(written, -1)
+	}
+	if err != nil {
+		if aborter, ok := out.(interface{ Abort() error }); ok {
+			aborter.Abort()
+		} else {
+			out.Close()
+		}
+		return result, err
+	}
+	if err := out.Close(); err != nil {
+		return result, fmt.Errorf("write %s to sink: %w", name, err)
+	}
+
+	result.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	result.Status = StatusDownloaded
+	result.Bytes = written
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package sds
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSink(t *testing.T) {
+	sink := FileSink{Dir: t.TempDir()}
+
+	out, err := sink.Create("by-host/c10005b.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(out, testPDF)
+	if _, err := os.Stat(filepath.Join(sink.Dir, "by-host", "c10005b.pdf")); !os.IsNotExist(err) {
+		t.Error("document visible before Close")
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(sink.Dir, "by-host", "c10005b.pdf")); err != nil || string(content) != testPDF {
+		t.Errorf("saved %q (error %v), want the document", content, err)
+	}
+
+	out, err = sink.Create("aborted.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(out, testPDF[:5])
+	if err := out.(interface{ Abort() error }).Abort(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"aborted.pdf", "aborted.pdf.part"} {
+		if _, err := os.Stat(filepath.Join(sink.Dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind after Abort", name)
+		}
+	}
+
+	if _, err := sink.Create("../x.pdf"); err == nil {
+		t.Error("Create accepted a name outside Dir")
+	}
+}
+
+func TestDownloadToSink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(testPDF))
+	}))
+	defer server.Close()
+	downloader := newTestDownloader(t, server, Config{})
+	sink := FileSink{Dir: t.TempDir()}
+	downloader.Sink = sink
+
+	result, err := downloader.Download(context.Background(), server.URL+"/C10005B.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != "c10005b.pdf" {
+		t.Errorf("path = %q, want the name relative to the sink", result.Path)
+	}
+	sha256, err := fileSHA256(filepath.Join(sink.Dir, "c10005b.pdf"))
+	if err != nil || sha256 != result.SHA256 {
+		t.Errorf("file SHA-256 = %s (error %v), result says %s", sha256, err, result.SHA256)
+	}
+	if files := savedFiles(t, downloader.OutputDir); len(files) > 0 {
+		t.Errorf("left %v in the output directory, want nothing", files)
+	}
+}
@@ -0,0 +1,62 @@
+package sds
+
+import "sync"
+
+// SourceInfo is what an input list knows about a source URL beyond the URL
+// itself, such as the product code and language columns of a CSV row
+type SourceInfo struct {
+	Code string // Product code, used as NameFields.Code instead of the one read from the URL ("" keeps that)
+	Lang string // Language, used as NameFields.Lang instead of the one read from the URL ("" keeps that)
+}
+
+// Remembers the SourceInfo given for each source URL and hands it on to the URL
+// it resolves to, so naming the download can use it
+type sourceInfoStore struct {
+	mu    sync.Mutex            // Guards byURL
+	byURL map[string]SourceInfo // Source or resolved URL → its info
+}
+
+// Describe attaches info to sourceURL, so the document it resolves to is named
+// with info's non-empty fields in place of the ones read from the URL. Call it
+// before resolving sourceURL.
+func (downloader *Downloader) Describe(sourceURL string, info SourceInfo) {
+	sourceURL = downloader.StripCredentials(sourceURL) // Keyed like the URL Resolve sees
+	store := downloader.sources
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.byURL[sourceURL] = info
+}
+
+// Hands the info of sourceURL, if it has any, on to the URL it resolved to
+func (store *sourceInfoStore) follow(sourceURL, resolvedURL string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if info, ok := store.byURL[sourceURL]; ok && resolvedURL != sourceURL {
+		store.byURL[resolvedURL] = info
+	}
+}
+
+// Returns the template fields for rawURL in Config.FilenameCase, with the
+// language of a path-named document split off under Config.TagLanguages,
+// overridden by its SourceInfo
+func (downloader *Downloader) nameFields(rawURL string) NameFields {
+	fields := nameFieldsFor(rawURL)
+	if downloader.TagLanguages && sdsSearchValue(rawURL) == "" {
+		fields.Code, fields.Lang = splitLanguageSuffix(fields.Name)
+		fields.Name = fields.Code + "_" + fields.Lang
+	}
+	store := downloader.sources
+	store.mu.Lock()
+	info := store.byURL[rawURL]
+	store.mu.Unlock()
+	if info.Code != "" {
+		fields.Code = info.Code
+	}
+	if info.Lang != "" {
+		fields.Lang = info.Lang
+	}
+	fields.Name = downloader.FilenameCase.apply(fields.Name)
+	fields.Code = downloader.FilenameCase.apply(fields.Code)
+	fields.Lang = downloader.FilenameCase.apply(fields.Lang)
+	return fields
+}
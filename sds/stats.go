@@ -0,0 +1,53 @@
+package sds
+
+import "sync/atomic"
+
+// Stats counts the outcomes of a run. All methods are safe for concurrent use,
+// so summaries, reports and metrics can read it while downloads are running.
+type Stats struct {
+	Downloaded         atomic.Int64 // PDFs written
+	Skipped            atomic.Int64 // URLs whose PDF was already present or that were filtered out
+	Failed             atomic.Int64 // URLs that could not be resolved or downloaded
+	InvalidContentType atomic.Int64 // Responses rejected for not being a PDF
+	BytesWritten       atomic.Int64 // Total size of the PDFs written
+}
+
+// RecordDownload counts a PDF of n bytes that was written
+func (stats *Stats) RecordDownload(n int64) {
+	stats.Downloaded.Add(1)
+	stats.BytesWritten.Add(n)
+}
+
+// RecordSkip counts a URL that needed no download
+func (stats *Stats) RecordSkip() {
+	stats.Skipped.Add(1)
+}
+
+// RecordFailure counts a URL that failed
+func (stats *Stats) RecordFailure() {
+	stats.Failed.Add(1)
+}
+
+// RecordInvalidContentType counts a response that was not a PDF
+func (stats *Stats) RecordInvalidContentType() {
+	stats.InvalidContentType.Add(1)
+}
+
+// Record counts an outcome by its status
+func (stats *Stats) Record(status Status, bytes int64) {
+	switch status {
+	case StatusDownloaded:
+		stats.RecordDownload(bytes)
+	case StatusSkipped:
+		stats.RecordSkip()
+	case StatusFailed:
+		stats.RecordFailure()
+	case StatusInvalidContentType:
+		stats.RecordInvalidContentType()
+	}
+}
+
+// HasFailures reports whether any URL failed to produce a PDF
+func (stats *Stats) HasFailures() bool {
+	return stats.Failed.Load() > 0 || stats.InvalidContentType.Load() > 0
+}
@@ -0,0 +1,39 @@
+package sds
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStatsConcurrent(t *testing.T) {
+	const goroutines, each = 16, 1000
+	statuses := []Status{StatusDownloaded, StatusSkipped, StatusFailed, StatusInvalidContentType}
+	stats := &Stats{}
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range each {
+				stats.Record(statuses[i%len(statuses)], 10)
+				stats.HasFailures() // Read while others write
+			}
+		}()
+	}
+	wg.Wait()
+
+	perStatus := int64(goroutines * each / len(statuses))
+	for name, got := range map[string]int64{
+		"Downloaded":         stats.Downloaded.Load(),
+		"Skipped":            stats.Skipped.Load(),
+		"Failed":             stats.Failed.Load(),
+		"InvalidContentType": stats.InvalidContentType.Load(),
+	} {
+		if got != perStatus {
+			t.Errorf("%s = %d, want %d", name, got, perStatus)
+		}
+	}
+	if got := stats.BytesWritten.Load(); got != 10*perStatus {
+		t.Errorf("BytesWritten = %d, want %d", got, 10*perStatus)
+	}
+}
@@ -0,0 +1,117 @@
+package sds
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/chromedp/cdproto/network" // Clearing cookies and cache between URLs
+	"github.com/chromedp/chromedp"        // External package to control Chrome/Chromium browser
+)
+
+// Longest wait for a used tab to be cleaned up before it goes back to the pool
+const tabResetTimeout = 5 * time.Second
+
+// An open browser tab lent to one Resolve at a time
+type browserTab struct {
+	ctx     context.Context    // Tab context that actions run in
+	cancel  context.CancelFunc // Closes the tab
+	browser *sharedBrowser     // Browser the tab belongs to
+	pooled  bool               // Whether the tab may go back to the pool after use
+}
+
+// Opens the Config.TabPool tabs of a newly launched browser ahead of the first
+// URL; must be called with mu held. Tabs that fail to open are opened on demand.
+func (shared *sharedBrowser) warmTabs(downloader *Downloader, browserCtx context.Context) {
+	for range downloader.TabPool {
+		tab, err := downloader.openTab(shared, browserCtx)
+		if err != nil {
+			slog.Debug("Failed to open a pooled tab", "error", err)
+			return
+		}
+		shared.idle = append(shared.idle, tab)
+	}
+}
+
+// Opens a pooled tab and creates its target right away. With Config.TabReset,
+// each tab gets a browser context of its own, so clearing its cookies can't
+// disturb a tab resolving another URL.
+func (downloader *Downloader) openTab(shared *sharedBrowser, browserCtx context.Context) (*browserTab, error) {
+	var options []chromedp.ContextOption
+	if downloader.TabReset {
+		options = append(options, chromedp.WithNewBrowserContext())
+	}
+	ctx, cancel := chromedp.NewContext(browserCtx, options...)
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &browserTab{ctx: ctx, cancel: cancel, browser: shared, pooled: true}, nil
+}
+
+// Lends a tab of the browser for the next proxy in the rotation: an idle one
+// from the pool when Config.TabPool is set, or else a new one
+func (downloader *Downloader) borrowTab() (*browserTab, error) {
+	shared := downloader.browsers[downloader.proxies.pick()]
+	browserCtx, err := downloader.launch(shared)
+	if err != nil {
+		return nil, err
+	}
+	if downloader.TabPool <= 0 { // A tab per URL, created by its first action
+		ctx, cancel := chromedp.NewContext(browserCtx)
+		return &browserTab{ctx: ctx, cancel: cancel, browser: shared}, nil
+	}
+
+	shared.mu.Lock()
+	for len(shared.idle) > 0 {
+		tab := shared.idle[len(shared.idle)-1]
+		shared.idle = shared.idle[:len(shared.idle)-1]
+		if tab.ctx.Err() == nil {
+			shared.mu.Unlock()
+			return tab, nil
+		}
+	}
+	shared.mu.Unlock()
+	return downloader.openTab(shared, browserCtx) // More workers than pooled tabs
+}
+
+// Takes a tab back after a Resolve. A healthy pooled tab is blanked (and with
+// Config.TabReset stripped of its cookies and cache) and kept for the next URL
+// while the pool has room; any other tab is closed.
+func (downloader *Downloader) returnTab(tab *browserTab, healthy bool) {
+	if !tab.pooled || !healthy || tab.ctx.Err() != nil || downloader.resetTab(tab) != nil {
+		tab.cancel()
+		return
+	}
+	shared := tab.browser
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if shared.ctx == nil || shared.ctx.Err() != nil || len(shared.idle) >= downloader.TabPool {
+		tab.cancel() // The browser was restarted or closed, or the pool is full
+		return
+	}
+	shared.idle = append(shared.idle, tab)
+}
+
+// Leaves the page of a used tab, so its scripts and timers stop, and with
+// Config.TabReset clears the cookies and cache of the tab's browser context
+func (downloader *Downloader) resetTab(tab *browserTab) error {
+	ctx, cancel := context.WithTimeout(tab.ctx, tabResetTimeout)
+	defer cancel()
+	actions := []chromedp.Action{chromedp.Navigate("about:blank")}
+	if downloader.TabReset {
+		actions = append(actions, network.ClearBrowserCookies(), network.ClearBrowserCache())
+	}
+	if err := chromedp.Run(ctx, actions...); err != nil {
+		slog.Debug("Failed to reset a pooled tab; closing it", "error", err)
+		return err
+	}
+	return nil
+}
+
+// Reports whether a tab that resolved a URL with the given outcome can serve
+// another one: the page itself may have refused or looped, but the tab is fine
+func tabReusable(err error) bool {
+	return err == nil || errors.Is(err, ErrBlocked) || errors.Is(err, ErrRedirectLoop)
+}
@@ -0,0 +1,39 @@
+package sds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// Compares resolving URLs in pooled tabs with opening a new tab for each one
+func BenchmarkResolveTabs(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>SDS</body></html>"))
+	}))
+	defer server.Close()
+
+	for _, bench := range []struct {
+		name    string
+		tabPool int
+	}{
+		{"pooled", 4},
+		{"tab per URL", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			downloader := newBrowserDownloader(b, Config{TabPool: bench.tabPool})
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if _, err := downloader.Resolve(context.Background(), server.URL+"/"+strconv.Itoa(i)); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package sds
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate" // Token bucket shared by all downloads
+)
+
+// Largest read passed through the limiter at once, and its burst size
+const throttleChunk = 32 << 10
+
+// Creates the limiter shared by all downloads for Config.MaxRate, or nil for no limit
+func newRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), throttleChunk)
+}
+
+// A reader that waits on a shared limiter for every byte it returns, so all
+// concurrent downloads together stay under the configured rate
+type throttledReader struct {
+	ctx     context.Context // Cancels a pending wait
+	reader  io.Reader       // Underlying response body
+	limiter *rate.Limiter   // Shared byte budget
+}
+
+// Reads at most one chunk and waits until the limiter allows that many bytes
+func (throttled *throttledReader) Read(buf []byte) (int, error) {
+	if len(buf) > throttleChunk {
+		buf = buf[:throttleChunk]
+	}
+	n, err := throttled.reader.Read(buf)
+	if n > 0 {
+		if waitErr := throttled.limiter.WaitN(throttled.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Wraps a response body in the download rate limit, if there is one
+func (downloader *Downloader) throttle(ctx context.Context, body io.Reader) io.Reader {
+	if downloader.limiter == nil {
+		return body
+	}
+	return &throttledReader{ctx: ctx, reader: body, limiter: downloader.limiter}
+}
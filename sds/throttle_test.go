@@ -0,0 +1,41 @@
+package sds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadThrottled(t *testing.T) {
+	const maxRate = 64 << 10 // Bytes per second
+	body := testPDF + strings.Repeat("x", 64<<10-len(testPDF))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	downloader := newTestDownloader(t, server, Config{MaxRate: maxRate})
+
+	// Two concurrent downloads share the rate: after the first chunk's burst,
+	// the remaining bytes take (2×64 KiB − 32 KiB) / 64 KiB/s = 1.5s
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, path := range []string{"/a.pdf", "/b.pdf"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := downloader.Download(context.Background(), server.URL+path); err != nil {
+				t.Errorf("%s: %v", path, err)
+			}
+		}()
+	}
+	wg.Wait()
+	want := time.Duration(float64(2*len(body)-throttleChunk) / maxRate * float64(time.Second))
+	if elapsed := time.Since(start); elapsed < want*8/10 || elapsed > want*3 {
+		t.Errorf("took %v, want about %v", elapsed, want)
+	}
+}
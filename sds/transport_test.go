@@ -0,0 +1,61 @@
+package sds
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+// Downloads from one host with several workers, reporting how many
+// connections the server saw opened per download
+func BenchmarkDownloadSameHost(b *testing.B) {
+	var opened atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte(testPDF))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			opened.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	const parallelism = 4
+	workers := parallelism * runtime.GOMAXPROCS(0)
+	for _, bench := range []struct {
+		name      string
+		idleConns int  // Config.IdleConnsPerHost
+		keepAlive bool // Whether connections are reused at all, as with a client per call
+	}{
+		{"idle conns per worker", workers, true},
+		{"default idle conns", 0, true},
+		{"no keep-alive", workers, false},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			downloader := New(Config{OutputDir: b.TempDir(), IdleConnsPerHost: bench.idleConns})
+			defer downloader.Close()
+			downloader.HTTPClient.Transport.(*http.Transport).DisableKeepAlives = !bench.keepAlive
+			var next atomic.Int64
+			opened.Store(0)
+
+			b.ResetTimer()
+			b.SetParallelism(parallelism)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					url := fmt.Sprintf("%s/%d.pdf", server.URL, next.Add(1))
+					if _, err := downloader.Download(context.Background(), url); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+			b.ReportMetric(float64(opened.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package sds
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultUserAgent is sent when Config.UserAgents is empty
+const DefaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36"
+
+// Hands out User-Agent strings round-robin and remembers which one resolved each
+// URL, so the download that follows presents the same client as the browser did
+type userAgentPool struct {
+	agents []string          // Strings to rotate through
+	next   atomic.Uint64     // Index of the next string to hand out
+	mu     sync.Mutex        // Guards byURL
+	byURL  map[string]string // Resolved URL → User-Agent used to resolve it
+}
+
+// Creates a pool rotating through agents, or sending DefaultUserAgent if empty
+func newUserAgentPool(agents []string) *userAgentPool {
+	if len(agents) == 0 {
+		agents = []string{DefaultUserAgent}
+	}
+	return &userAgentPool{agents: agents, byURL: make(map[string]string)}
+}
+
+// Returns the next User-Agent in the rotation
+func (pool *userAgentPool) pick() string {
+	index := pool.next.Add(1) - 1
+	return pool.agents[index%uint64(len(pool.agents))]
+}
+
+// Records the User-Agent that resolved a URL
+func (pool *userAgentPool) remember(resolvedURL, agent string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.byURL[resolvedURL] = agent
+}
+
+// Returns the User-Agent that resolved finalURL, or the next one in the rotation
+// for URLs that were never resolved
+func (pool *userAgentPool) forURL(finalURL string) string {
+	pool.mu.Lock()
+	agent, ok := pool.byURL[finalURL]
+	pool.mu.Unlock()
+	if ok {
+		return agent
+	}
+	return pool.pick()
+}
+
+// Returns the User-Agent that resolved rawURL, or the one the next resolution will
+// use, without advancing the rotation
+func (pool *userAgentPool) peek(rawURL string) string {
+	pool.mu.Lock()
+	agent, ok := pool.byURL[rawURL]
+	pool.mu.Unlock()
+	if ok {
+		return agent
+	}
+	return pool.agents[pool.next.Load()%uint64(len(pool.agents))]
+}
@@ -0,0 +1,64 @@
+package sds
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/ledongthuc/pdf" // Pure-Go PDF parser
+)
+
+// ErrInvalidPDF is returned by Download with Config.ValidatePDF when a PDF is
+// corrupt, truncated or password-protected; the file is quarantined instead
+var ErrInvalidPDF = errors.New("unreadable PDF")
+
+// QuarantineDirectory is the directory inside OutputDir holding PDFs that failed validation
+const QuarantineDirectory = "invalid"
+
+// Checks that the size bytes of content parse as a PDF that opens without a
+// password and has a readable first page
+func validatePDF(content io.ReaderAt, size int64) (err error) {
+	defer func() { // The parser panics on some malformed input
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%w: %v", ErrInvalidPDF, recovered)
+		}
+	}()
+	reader, err := pdf.NewReader(content, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPDF, err)
+	}
+	if reader.NumPage() < 1 {
+		return fmt.Errorf("%w: no pages", ErrInvalidPDF)
+	}
+	page := reader.Page(1)
+	if page.V.IsNull() {
+		return fmt.Errorf("%w: first page missing", ErrInvalidPDF)
+	}
+	page.Content() // Decodes the page's content streams, which fails on truncated files
+	return nil
+}
+
+// Moves the downloaded file at partialPath, which failed validation, to
+// OutputDir/invalid under the name of filePath for inspection and returns
+// where it went
+func (downloader *Downloader) quarantine(partialPath, filePath string, size int64, sha256 string) (string, error) {
+	downloader.writeMu.Lock()
+	defer downloader.writeMu.Unlock()
+	directory := filepath.Join(downloader.OutputDir, QuarantineDirectory)
+	if err := CreateDirectory(directory, 0o755); err != nil {
+		return "", err
+	}
+	quarantinePath, duplicate := availablePath(filepath.Join(directory, filepath.Base(filePath)), size, sha256)
+	if duplicate {
+		discardPartial(partialPath)
+		return quarantinePath, nil
+	}
+	if err := os.Rename(partialPath, quarantinePath); err != nil {
+		return "", err
+	}
+	slog.Debug("Quarantined invalid PDF", "path", quarantinePath)
+	return quarantinePath, nil
+}
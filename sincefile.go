@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reads the start time of the last successful run from a -since-file. A
+// missing file gives the zero time, so the first run fetches everything.
+func readSinceFile(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	since, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: want an RFC3339 time: %w", path, err)
+	}
+	return since, nil
+}
+
+// Records runStart in a -since-file as the baseline for the next run. The
+// start rather than the end is kept, so documents updated while the run was
+// going are fetched next time.
+func writeSinceFile(path string, runStart time.Time) error {
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(runStart.UTC().Format(time.RFC3339)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path) // Never leave a half-written time behind
+}
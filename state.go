@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Statuses a source URL can have in the -state file
+const (
+	statePending = "pending" // Not processed yet, or interrupted
+	stateDone    = "done"    // Downloaded, or skipped because nothing needed doing
+	stateFailed  = "failed"  // Could not be resolved or downloaded; retried on the next run
+)
+
+// One source URL's entry in the -state file
+type stateEntry struct {
+	Status   string    `json:"status"`                 // pending, done or failed
+	Resolved string    `json:"resolved_url,omitempty"` // URL after following redirects
+	Error    string    `json:"error,omitempty"`        // Why the URL last failed
+	Updated  time.Time `json:"updated"`                // When the entry last changed
+}
+
+// Progress of a run persisted after every URL, so an interrupted run can pick
+// up where it stopped instead of resolving finished URLs again
+type runState struct {
+	mu      sync.Mutex            // Guards entries and the file on disk
+	path    string                // Location of the JSON file
+	entries map[string]stateEntry // Source URL → entry
+}
+
+// Reads the state file at path; a missing file starts an empty state
+func loadRunState(path string) (*runState, error) {
+	state := &runState{path: path, entries: make(map[string]stateEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state.entries); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Returns the URLs still to do, recording new ones as pending. Finished URLs
+// are left out unless redo is set.
+func (state *runState) remaining(urls []string, redo bool) []string {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	remaining := make([]string, 0, len(urls))
+	for _, sourceURL := range urls {
+		entry, ok := state.entries[sourceURL]
+		if ok && entry.Status == stateDone && !redo {
+			continue
+		}
+		if !ok {
+			state.entries[sourceURL] = stateEntry{Status: statePending, Updated: time.Now().UTC()}
+		}
+		remaining = append(remaining, sourceURL)
+	}
+	if done := len(urls) - len(remaining); done > 0 {
+		slog.Info("Resuming run; skipping URLs finished earlier", "done", done, "remaining", len(remaining), "state", state.path)
+	}
+	state.save()
+	return remaining
+}
+
+// Records the outcome of a URL and persists the state
+func (state *runState) record(outcome urlOutcome) {
+	entry := stateEntry{Status: stateDone, Resolved: outcome.Resolved, Updated: time.Now().UTC()}
+	if outcome.Err != nil {
+		entry.Status, entry.Error = stateFailed, outcome.Err.Error()
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.entries[outcome.Source] = entry
+	state.save()
+}
+
+// Writes the state file atomically; must be called with mu held
+func (state *runState) save() {
+	data, err := json.MarshalIndent(state.entries, "", "  ")
+	if err == nil {
+		tempPath := state.path + ".tmp"
+		if err = os.WriteFile(tempPath, append(data, '\n'), 0o644); err == nil {
+			err = os.Rename(tempPath, state.path)
+		}
+	}
+	if err != nil {
+		slog.Warn("Failed to save state file", "path", state.path, "error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Download outcomes
+)
+
+// End-of-run report built from the downloader's counters
+type runSummary struct {
+	stats    *sds.Stats            // Counters shared with the downloader
+	started  time.Time             // When the run began
+	mu       sync.Mutex            // Guards failures
+	failures map[sds.ErrorKind]int // Failed URLs by kind of failure
+}
+
+// Creates a summary over stats whose elapsed time starts now
+func newRunSummary(stats *sds.Stats) *runSummary {
+	return &runSummary{stats: stats, started: time.Now(), failures: make(map[sds.ErrorKind]int)}
+}
+
+// Counts the kind of failure of a URL that failed
+func (summary *runSummary) add(outcome urlOutcome) {
+	if outcome.Err == nil {
+		return
+	}
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+	summary.failures[sds.ErrorKindOf(outcome.Err)]++
+}
+
+// Writes the formatted end-of-run report
+func (summary *runSummary) print(writer io.Writer) {
+	stats := summary.stats
+	fmt.Fprintln(writer, "Summary:")
+	fmt.Fprintf(writer, "  Downloaded:           %d\n", stats.Downloaded.Load())
+	fmt.Fprintf(writer, "  Skipped:              %d\n", stats.Skipped.Load())
+	fmt.Fprintf(writer, "  Failed:               %d\n", stats.Failed.Load())
+	fmt.Fprintf(writer, "  Invalid content type: %d\n", stats.InvalidContentType.Load())
+	summary.mu.Lock()
+	kinds := slices.Sorted(maps.Keys(summary.failures))
+	for _, kind := range kinds {
+		fmt.Fprintf(writer, "    %-20s%d\n", kind+":", summary.failures[kind])
+	}
+	summary.mu.Unlock()
+	fmt.Fprintf(writer, "  Bytes written:        %s\n", formatBytes(stats.BytesWritten.Load()))
+	fmt.Fprintf(writer, "  Elapsed:              %s\n", time.Since(summary.started).Round(time.Second))
+}
+
+// Formats a byte count for humans (e.g. 131072 → "128 KiB")
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, exponent := float64(bytes)/unit, 0
+	for value >= unit && exponent < 4 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exponent])
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Tech-Trailblazers/citgolubes-com-documentation/sds" // Manifest reading and file checks
+)
+
+// Counts of the problems the verify subcommand found
+type verifyResult struct {
+	Checked int // Manifest entries looked at
+	Missing int // Entries whose file is gone
+	Corrupt int // Entries whose file has the wrong size or checksum
+	Extra   int // Files in the output directory the manifest doesn't list
+	Unknown int // Files without a download record, e.g. saved before the metadata existed
+}
+
+// Reports whether anything in the mirror differs from the manifest
+func (result verifyResult) failed() bool {
+	return result.Missing+result.Corrupt+result.Extra > 0
+}
+
+// Checks the files in outputDir against the manifest at manifestPath, printing a
+// tab-separated "missing", "corrupt" or "extra" line to out for each problem.
+// With checkHash, every file's SHA-256 is recomputed as well as its size.
+func verifyMirror(out io.Writer, outputDir, manifestPath string, checkHash bool) (verifyResult, error) {
+	var result verifyResult
+	entries, err := sds.ReadManifest(manifestPath)
+	if err != nil {
+		return result, err
+	}
+
+	listed := make(map[string]bool, len(entries)) // Manifest paths, for spotting extra files
+	for _, entry := range entries {
+		listed[entry.Path] = true
+		result.Checked++
+		switch err := sds.CheckManifestEntry(outputDir, entry, checkHash); {
+		case errors.Is(err, os.ErrNotExist):
+			result.Missing++
+			fmt.Fprintf(out, "missing\t%s\n", entry.Path)
+		case err != nil:
+			result.Corrupt++
+			fmt.Fprintf(out, "corrupt\t%s\t%v\n", entry.Path, err)
+		}
+	}
+
+	recorded, err := sds.RecordedFiles(outputDir) // Files the tool knows it downloaded
+	if err != nil {
+		return result, err
+	}
+	manifestAbs, _ := filepath.Abs(manifestPath)
+	err = filepath.WalkDir(outputDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != outputDir && strings.HasPrefix(entry.Name(), ".") { // Metadata and caches
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() && path == filepath.Join(outputDir, sds.QuarantineDirectory) {
+			return filepath.SkipDir // Quarantined PDFs are kept out of the manifest on purpose
+		}
+		if entry.IsDir() || bookkeepingFile(path, manifestAbs) {
+			return nil
+		}
+		relative, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		switch relative = filepath.ToSlash(relative); {
+		case listed[relative]:
+		case !recorded[relative]: // Nothing to compare it with, rather than a problem
+			result.Unknown++
+		default:
+			result.Extra++
+			fmt.Fprintf(out, "extra\t%s\n", relative)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Reports whether a file in the output directory is written by the tool itself
+// rather than downloaded: the manifest, sha256sums.txt, duplicates.csv or an
+// unfinished ".part"
+func bookkeepingFile(path, manifestAbs string) bool {
+	if absolute, err := filepath.Abs(path); err == nil && absolute == manifestAbs {
+		return true
+	}
+	switch filepath.Base(path) {
+	case checksumsFilename, duplicatesFilename:
+		return true
+	}
+	return strings.HasSuffix(path, ".part")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyMirror(t *testing.T) {
+	outputDir := t.TempDir()
+	files := map[string]string{
+		"c10005b.pdf":        "%PDF-",
+		"manifest.csv":       "path,url,size,sha256,downloaded\nc10005b.pdf,http://www.docs.citgo.com/msds_pi/C10005B.pdf,5,,\n",
+		"stray.pdf":          "%PDF-",
+		"invalid/broken.pdf": "%PDF-broken", // Quarantined by validation, never in the manifest
+		"legacy.pdf":         "%PDF-",       // Saved before the download metadata existed
+		".sds-metadata.json": `{"c10005b.pdf": {"url": "http://www.docs.citgo.com/msds_pi/C10005B.pdf", "size": 5},
+			"stray.pdf": {"url": "http://www.docs.citgo.com/msds_pi/stray.pdf", "size": 5}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(outputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out strings.Builder
+	result, err := verifyMirror(&out, outputDir, filepath.Join(outputDir, "manifest.csv"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Checked != 1 || result.Missing != 0 || result.Corrupt != 0 || result.Extra != 1 || result.Unknown != 1 {
+		t.Errorf("result = %+v, want 1 checked, stray.pdf extra and legacy.pdf unknown", result)
+	}
+	if out.String() != "extra\tstray.pdf\n" {
+		t.Errorf("printed %q, want only stray.pdf reported", out.String())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Rough memory each worker needs under -workers auto: a resolver drives a
+// Chrome tab, a downloader holds a response in flight
+const (
+	resolverMemory   = 300 << 20
+	downloaderMemory = 64 << 20
+)
+
+// Picks the resolver and download worker counts for -workers auto from the
+// CPUs and available memory, keeping resolvers fewer than downloaders
+func autoWorkers() (resolve, download int) {
+	cpus := runtime.NumCPU()
+	resolve = max(cpus/2, 1)
+	download = max(cpus*2, 2)
+	if available, ok := availableMemory(); ok {
+		budget := available / 2 // Leave the rest to Chrome's own processes and the system
+		resolve = min(resolve, max(int(budget/resolverMemory), 1))
+		download = min(download, max(int((budget-int64(resolve)*resolverMemory)/downloaderMemory), 2))
+	}
+	return min(resolve, max(download-1, 1), 8), min(download, 32)
+}
+
+// Returns the memory available to new processes, read from /proc/meminfo. The
+// Go runtime only knows its own heap, so elsewhere the CPUs alone decide.
+func availableMemory() (int64, bool) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text()) // e.g. "MemAvailable:  8042412 kB"
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kib, err := strconv.ParseInt(fields[1], 10, 64)
+		return kib << 10, err == nil
+	}
+	return 0, false
+}